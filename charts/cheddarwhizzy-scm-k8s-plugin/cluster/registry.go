@@ -0,0 +1,187 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ErrUnknownCluster is returned for a cluster that is not in the registry
+var ErrUnknownCluster = errors.New("cluster is not in the cluster registry")
+
+// Cluster is a deployment target known to ArgoCD
+type Cluster struct {
+	// Name is the cluster name used in repository paths and repo names
+	Name string `yaml:"name"`
+	// DestinationName is the ArgoCD cluster name; defaults to Name when Server is empty
+	DestinationName string `yaml:"destinationName,omitempty"`
+	// Server is the ArgoCD cluster API server URL, an alternative to DestinationName
+	Server string `yaml:"server,omitempty"`
+	// Namespaces lists the namespaces (globs) Applications may deploy to; empty allows all
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// Env is the environment the cluster serves; only clusters of an env are selected for it
+	Env string `yaml:"env,omitempty"`
+	// Labels are matched by the cluster selectors of project-info.yaml
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// AllowsNamespace reports whether Applications may deploy to namespace
+func (c *Cluster) AllowsNamespace(namespace string) bool {
+	if len(c.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range c.Namespaces {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// registryFile is the format of a cluster registry file
+type registryFile struct {
+	Clusters []Cluster `yaml:"clusters"`
+}
+
+// Registry maps cluster names to ArgoCD destinations
+type Registry struct {
+	mu       sync.RWMutex
+	clusters map[string]*Cluster
+}
+
+// NewRegistry validates clusters and builds a registry from them
+func NewRegistry(clusters []Cluster) (*Registry, error) {
+	r := &Registry{}
+	if err := r.Replace(clusters); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRegistry reads and validates a cluster registry file
+func LoadRegistry(file string) (*Registry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster registry: %w", err)
+	}
+
+	var parsed registryFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&parsed); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse cluster registry %s: %w", file, err)
+	}
+	if len(parsed.Clusters) == 0 {
+		return nil, fmt.Errorf("invalid cluster registry %s: no clusters defined", file)
+	}
+
+	registry, err := NewRegistry(parsed.Clusters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster registry %s: %w", file, err)
+	}
+	return registry, nil
+}
+
+// Replace validates clusters and swaps them in as the registry contents
+func (r *Registry) Replace(clusters []Cluster) error {
+	byName := make(map[string]*Cluster, len(clusters))
+	var errs []error
+	for i := range clusters {
+		c := clusters[i]
+		if c.Name == "" {
+			errs = append(errs, fmt.Errorf("cluster %d: name is required", i))
+			continue
+		}
+		if _, exists := byName[c.Name]; exists {
+			errs = append(errs, fmt.Errorf("cluster %s is defined twice", c.Name))
+			continue
+		}
+		for _, pattern := range c.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("cluster %s: invalid namespace pattern %q: %w", c.Name, pattern, err))
+			}
+		}
+		keys := make([]string, 0, len(c.Labels))
+		for key := range c.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if problems := validation.IsQualifiedName(key); len(problems) > 0 {
+				errs = append(errs, fmt.Errorf("cluster %s: invalid label key %q: %s", c.Name, key, strings.Join(problems, "; ")))
+			}
+			if problems := validation.IsValidLabelValue(c.Labels[key]); len(problems) > 0 {
+				errs = append(errs, fmt.Errorf("cluster %s: invalid value of label %s: %s", c.Name, key, strings.Join(problems, "; ")))
+			}
+		}
+		// ArgoCD rejects destinations with both a name and a server
+		if c.DestinationName != "" && c.Server != "" {
+			errs = append(errs, fmt.Errorf("cluster %s: destinationName and server are mutually exclusive", c.Name))
+		}
+		if c.DestinationName == "" && c.Server == "" {
+			c.DestinationName = c.Name
+		}
+		byName[c.Name] = &c
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clusters = byName
+	return nil
+}
+
+// Lookup returns the cluster named name
+func (r *Registry) Lookup(name string) (*Cluster, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, exists := r.clusters[name]
+	if !exists {
+		return nil, fmt.Errorf("%q: %w", name, ErrUnknownCluster)
+	}
+	found := *c
+	return &found, nil
+}
+
+// Names returns the names of all registered clusters in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.clusters))
+	for name := range r.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the clusters of env whose labels match selector, sorted by name
+func (r *Registry) Select(env string, selector labels.Selector) []Cluster {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var selected []Cluster
+	for _, c := range r.clusters {
+		if c.Env == env && selector.Matches(labels.Set(c.Labels)) {
+			selected = append(selected, *c)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Name < selected[j].Name
+	})
+	return selected
+}
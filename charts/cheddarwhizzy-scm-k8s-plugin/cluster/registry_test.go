@@ -0,0 +1,26 @@
+package cluster
+
+import "testing"
+
+func TestRegistryReplace(t *testing.T) {
+	tests := []struct {
+		name     string
+		clusters []Cluster
+		wantErr  bool
+	}{
+		{"name defaults destination", []Cluster{{Name: "prod-east"}}, false},
+		{"server", []Cluster{{Name: "prod-east", Server: "https://prod-east.example.com"}}, false},
+		{"destinationName and server", []Cluster{{Name: "prod-east", DestinationName: "east", Server: "https://prod-east.example.com"}}, true},
+		{"duplicate", []Cluster{{Name: "prod-east"}, {Name: "prod-east"}}, true},
+		{"missing name", []Cluster{{Server: "https://prod-east.example.com"}}, true},
+		{"invalid namespace glob", []Cluster{{Name: "prod-east", Namespaces: []string{"["}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.clusters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRegistry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
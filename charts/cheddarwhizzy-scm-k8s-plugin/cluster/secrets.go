@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// SecretTypeLabel marks the Secrets ArgoCD stores cluster credentials in
+const SecretTypeLabel = "argocd.argoproj.io/secret-type"
+
+// InClusterServer is the API server ArgoCD deploys to its own cluster through
+const InClusterServer = "https://kubernetes.default.svc"
+
+// InCluster is the cluster ArgoCD runs in. ArgoCD knows it without a secret,
+// so SecretSource adds it unless a secret renames or reconfigures it.
+var InCluster = Cluster{Name: "in-cluster", DestinationName: "in-cluster"}
+
+// SecretSource reads clusters from ArgoCD cluster secrets: Secrets labelled
+// argocd.argoproj.io/secret-type=cluster with name, server and namespaces keys.
+// Clusters are addressed by name, which ArgoCD requires to be unique.
+type SecretSource struct {
+	client    kubernetes.Interface
+	namespace string
+	envLabel  string
+}
+
+// NewSecretSource creates a source listing cluster secrets in namespace.
+// The env of a cluster is read from the secret label envLabel.
+func NewSecretSource(client kubernetes.Interface, namespace, envLabel string) *SecretSource {
+	return &SecretSource{
+		client:    client,
+		namespace: namespace,
+		envLabel:  envLabel,
+	}
+}
+
+// NewInClusterSecretSource creates a secret source using the pod's service account
+func NewInClusterSecretSource(namespace, envLabel string) (*SecretSource, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return NewSecretSource(client, namespace, envLabel), nil
+}
+
+// Clusters lists the cluster secrets and converts them to clusters, plus
+// InCluster. Secrets without a name or server are skipped. Without any
+// cluster secret nothing is returned, not even InCluster.
+func (s *SecretSource) Clusters(ctx context.Context) ([]Cluster, error) {
+	secrets, err := s.client.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: SecretTypeLabel + "=cluster",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster secrets in %s: %w", s.namespace, err)
+	}
+	if len(secrets.Items) == 0 {
+		return nil, nil
+	}
+
+	clusters := make([]Cluster, 0, len(secrets.Items)+1)
+	inCluster := true
+	for _, secret := range secrets.Items {
+		name := string(secret.Data["name"])
+		server := string(secret.Data["server"])
+		if name == "" || server == "" {
+			log.Printf("Warning: skipping cluster secret %s/%s without name or server", secret.Namespace, secret.Name)
+			continue
+		}
+
+		labels := make(map[string]string, len(secret.Labels))
+		for key, value := range secret.Labels {
+			if key != SecretTypeLabel {
+				labels[key] = value
+			}
+		}
+
+		c := Cluster{
+			Name:            name,
+			DestinationName: name,
+			Env:             secret.Labels[s.envLabel],
+			Labels:          labels,
+		}
+		// ArgoCD stores namespace-scoped clusters as a comma-separated list
+		for _, namespace := range strings.Split(string(secret.Data["namespaces"]), ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				c.Namespaces = append(c.Namespaces, namespace)
+			}
+		}
+		clusters = append(clusters, c)
+		if name == InCluster.Name || server == InClusterServer {
+			inCluster = false
+		}
+	}
+	if inCluster {
+		clusters = append(clusters, InCluster)
+	}
+	return clusters, nil
+}
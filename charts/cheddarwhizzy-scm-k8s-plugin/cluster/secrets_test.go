@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// clusterSecret builds an ArgoCD cluster secret
+func clusterSecret(name string, labels map[string]string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "argocd",
+			Labels:    map[string]string{SecretTypeLabel: "cluster"},
+		},
+		Data: make(map[string][]byte),
+	}
+	for key, value := range labels {
+		secret.Labels[key] = value
+	}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+func TestSecretSourceClusters(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		clusterSecret("prod-east", map[string]string{"env": "prod", "region": "us"}, map[string]string{
+			"name":       "prod-east",
+			"server":     "https://prod-east.example.com",
+			"namespaces": "payments, billing,,",
+		}),
+		clusterSecret("no-server", nil, map[string]string{"name": "broken"}),
+		// Not a cluster secret
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "repo", Namespace: "argocd"}},
+	)
+
+	clusters, err := NewSecretSource(client, "argocd", "env").Clusters(context.Background())
+	if err != nil {
+		t.Fatalf("Clusters: %v", err)
+	}
+	want := []Cluster{
+		{
+			Name:            "prod-east",
+			DestinationName: "prod-east",
+			Namespaces:      []string{"payments", "billing"},
+			Env:             "prod",
+			Labels:          map[string]string{"env": "prod", "region": "us"},
+		},
+		InCluster,
+	}
+	if !reflect.DeepEqual(clusters, want) {
+		t.Errorf("Clusters() = %+v, want %+v", clusters, want)
+	}
+}
+
+func TestSecretSourceInClusterSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		clusterSecret("local", nil, map[string]string{"name": "management", "server": InClusterServer}),
+	)
+
+	clusters, err := NewSecretSource(client, "argocd", "env").Clusters(context.Background())
+	if err != nil {
+		t.Fatalf("Clusters: %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "management" {
+		t.Errorf("in-cluster added although a secret configures it: %+v", clusters)
+	}
+}
+
+func TestRegistrySync(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		clusterSecret("prod-east", map[string]string{"env": "prod"}, map[string]string{
+			"name":   "prod-east",
+			"server": "https://prod-east.example.com",
+		}),
+	)
+	source := NewSecretSource(client, "argocd", "env")
+	registry, err := NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Sync(context.Background(), source); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"in-cluster", "prod-east"}) {
+		t.Errorf("Names() = %v", names)
+	}
+
+	// A duplicate name invalidates the inventory; the previous one is kept
+	duplicate := clusterSecret("prod-east-2", nil, map[string]string{"name": "prod-east", "server": "https://other.example.com"})
+	if _, err := client.CoreV1().Secrets("argocd").Create(context.Background(), duplicate, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Sync(context.Background(), source); err == nil {
+		t.Error("Sync accepted two clusters named prod-east")
+	}
+	if c, err := registry.Lookup("prod-east"); err != nil || c.DestinationName != "prod-east" {
+		t.Errorf("Lookup after failed sync = %+v, %v", c, err)
+	}
+
+	// So is it when the secrets disappear, e.g. after an RBAC change
+	for _, name := range []string{"prod-east", "prod-east-2"} {
+		if err := client.CoreV1().Secrets("argocd").Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Sync(context.Background(), source); !errors.Is(err, ErrNoClusters) {
+		t.Errorf("Sync of an empty listing = %v, want ErrNoClusters", err)
+	}
+	if _, err := registry.Lookup("prod-east"); err != nil {
+		t.Errorf("cluster removed by an empty listing: %v", err)
+	}
+}
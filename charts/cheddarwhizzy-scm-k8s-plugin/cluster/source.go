@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrNoClusters is returned by Sync when the source lists no clusters. An
+// empty listing is usually an RBAC or label change rather than every cluster
+// being removed, so the previous contents are kept.
+var ErrNoClusters = errors.New("source listed no clusters")
+
+// Source provides the current cluster inventory
+type Source interface {
+	Clusters(ctx context.Context) ([]Cluster, error)
+}
+
+// Sync replaces the registry contents with the clusters of source.
+// On error, including an empty listing, the previous contents are kept.
+func (r *Registry) Sync(ctx context.Context, source Source) error {
+	clusters, err := source.Clusters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list clusters: %w", err)
+	}
+	if len(clusters) == 0 {
+		return ErrNoClusters
+	}
+	if err := r.Replace(clusters); err != nil {
+		return fmt.Errorf("invalid cluster inventory: %w", err)
+	}
+	return nil
+}
+
+// Poll syncs the registry from source every interval until ctx is done,
+// so added and removed clusters are picked up without a restart
+func (r *Registry) Poll(ctx context.Context, source Source, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := r.Names()
+			if err := r.Sync(ctx, source); err != nil {
+				log.Printf("Warning: keeping previous cluster registry: %v", err)
+				continue
+			}
+			if after := r.Names(); fmt.Sprint(before) != fmt.Sprint(after) {
+				log.Printf("Cluster registry changed: %v", after)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseChart parses a Chart.yaml. Unknown fields are ignored since Chart.yaml
+// has many fields the plugin does not use.
+func ParseChart(data []byte) (*types.Chart, error) {
+	var chart types.Chart
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+
+	var errs []error
+	if chart.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if chart.Version == "" {
+		errs = append(errs, errors.New("version is required"))
+	}
+	for i, dependency := range chart.Dependencies {
+		if dependency.Name == "" {
+			errs = append(errs, fmt.Errorf("dependencies[%d]: name is required", i))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &chart, nil
+}
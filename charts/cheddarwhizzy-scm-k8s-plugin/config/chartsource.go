@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// ParseChartSource parses and validates a chart-source.yaml
+func ParseChartSource(data []byte) (*types.ChartSource, error) {
+	var source types.ChartSource
+	if err := decodeStrict(data, &source); err != nil {
+		return nil, fmt.Errorf("failed to parse chart source: %w", err)
+	}
+	if err := ValidateChartSource(&source); err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// ValidateChartSource checks a reference to a chart in a Helm repository
+// (http/https) or OCI registry (oci://, or a registry path without scheme)
+func ValidateChartSource(source *types.ChartSource) error {
+	var errs []error
+
+	switch {
+	case source.RepoURL == "":
+		errs = append(errs, errors.New("repoURL is required"))
+	case strings.Contains(source.RepoURL, "://"):
+		u, err := url.Parse(source.RepoURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid repoURL: %w", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci" {
+			errs = append(errs, fmt.Errorf("repoURL %q must be a Helm repository (http, https) or OCI registry (oci)", source.RepoURL))
+		} else if u.Host == "" {
+			errs = append(errs, fmt.Errorf("repoURL %q has no host", source.RepoURL))
+		}
+	case strings.ContainsAny(source.RepoURL, " \t") || !strings.Contains(strings.Split(source.RepoURL, "/")[0], "."):
+		// ArgoCD OCI repositories are written without a scheme: registry.example.com/charts
+		errs = append(errs, fmt.Errorf("repoURL %q is neither a URL nor an OCI registry path", source.RepoURL))
+	}
+
+	switch {
+	case source.Chart == "":
+		errs = append(errs, errors.New("chart is required"))
+	case strings.ContainsAny(source.Chart, "/: \t"):
+		errs = append(errs, fmt.Errorf("chart %q must be a chart name; put the registry path in repoURL and the version in targetRevision", source.Chart))
+	}
+
+	// A version or a semver constraint such as ">=1.2.0 <2.0.0"
+	if strings.TrimSpace(source.TargetRevision) == "" {
+		errs = append(errs, errors.New("targetRevision (the chart version) is required"))
+	}
+
+	if source.Path != "" {
+		errs = append(errs, errors.New("path cannot be combined with an external chart"))
+	}
+	return errors.Join(errs...)
+}
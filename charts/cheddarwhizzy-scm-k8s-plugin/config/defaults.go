@@ -9,12 +9,12 @@ func DefaultMonorepoLayout() *types.LayoutConfig {
 	typeIndex := 1
 	namespaceIndex := 2
 	chartIndex := 3
-	staticCluster := "in-cluster"
+	clusterIndex := 0
 
 	return &types.LayoutConfig{
 		Strategy: types.LayoutMonorepo,
 		ClusterResolver: types.ClusterResolver{
-			Static: &staticCluster, // Currently hard-coded to "in-cluster"
+			FromPathIndex: &clusterIndex, // Cluster name is the first path segment
 		},
 		PathStructure: types.PathStructure{
 			TypeIndex:      typeIndex,
@@ -24,12 +24,24 @@ func DefaultMonorepoLayout() *types.LayoutConfig {
 	}
 }
 
+// StaticClusterMonorepoLayout returns the default monorepo layout deploying
+// every path to in-cluster, used when no cluster registry is configured
+func StaticClusterMonorepoLayout() *types.LayoutConfig {
+	layoutConfig := DefaultMonorepoLayout()
+	staticCluster := "in-cluster"
+	layoutConfig.ClusterResolver = types.ClusterResolver{
+		Static: &staticCluster,
+	}
+	return layoutConfig
+}
+
 // DefaultSplitByEnvLayout returns the default layout config for kubernetes-<env>-<cluster> repos
 func DefaultSplitByEnvLayout() *types.LayoutConfig {
 	typeIndex := 0
 	namespaceIndex := 1
 	chartIndex := 2
-	repoPattern := "kubernetes-(.+)-(.+)"
+	// The env is the first segment, so clusters may contain dashes
+	repoPattern := "^kubernetes-(?P<env>[^-]+)-(?P<cluster>.+)$"
 
 	return &types.LayoutConfig{
 		Strategy: types.LayoutSplitByEnv,
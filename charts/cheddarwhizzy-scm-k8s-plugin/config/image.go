@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseImage parses the image of an image.yaml or image-<cluster>.yaml, either
+// a repository/tag map or an image reference such as "nginx:1.25".
+// Other values in the file are ignored.
+func ParseImage(data []byte) (*types.Image, error) {
+	var values struct {
+		Image yaml.Node `yaml:"image"`
+	}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse image values: %w", err)
+	}
+
+	var image types.Image
+	switch values.Image.Kind {
+	case 0:
+		// No image key
+	case yaml.ScalarNode:
+		image = parseImageReference(values.Image.Value)
+	case yaml.MappingNode:
+		if err := values.Image.Decode(&image); err != nil {
+			return nil, fmt.Errorf("failed to parse image values: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("image must be a reference or a map with repository and tag, line %d", values.Image.Line)
+	}
+	return &image, nil
+}
+
+// parseImageReference splits an image reference into repository and tag. A
+// digest is dropped, and a colon before the last slash is a registry port.
+func parseImageReference(reference string) types.Image {
+	reference, _, _ = strings.Cut(reference, "@")
+	slash := strings.LastIndex(reference, "/")
+	if colon := strings.LastIndex(reference, ":"); colon > slash {
+		return types.Image{Repository: reference[:colon], Tag: reference[colon+1:]}
+	}
+	return types.Image{Repository: reference}
+}
@@ -1,27 +1,201 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"strings"
 
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/layout"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"gopkg.in/yaml.v3"
 )
 
-// GetLayoutConfigForRepo determines the appropriate layout config for a repository
-// Uses pattern matching to detect repo type
-func GetLayoutConfigForRepo(repoName string) *types.LayoutConfig {
-	// Check for split-by-env pattern: kubernetes-<env>-<cluster>
-	splitPattern := regexp.MustCompile(`^kubernetes-.+-.+$`)
-	if splitPattern.MatchString(repoName) {
-		return DefaultSplitByEnvLayout()
+// DefaultLayoutRules returns the rules used without a layout config file:
+// kubernetes-<env>-<cluster> repos are split-by-env, kubernetes-manifests*
+// repos are monorepos and all other repos are business apps. Monorepo paths
+// name their cluster in the first segment only with a cluster registry to
+// check it against; without one they deploy to in-cluster.
+func DefaultLayoutRules(registry bool) []types.LayoutRule {
+	if registry {
+		return defaultLayoutRules
+	}
+	return staticClusterLayoutRules
+}
+
+var defaultLayoutRules = []types.LayoutRule{
+	defaultLayoutRule(`(^|/)kubernetes-[^/]+-[^/]+$`, DefaultSplitByEnvLayout()),
+	defaultLayoutRule(`(^|/)kubernetes-manifests[^/]*$`, DefaultMonorepoLayout()),
+	defaultLayoutRule(`.*`, DefaultBusinessAppLayout()),
+}
+
+var staticClusterLayoutRules = []types.LayoutRule{
+	defaultLayoutRule(`(^|/)kubernetes-[^/]+-[^/]+$`, DefaultSplitByEnvLayout()),
+	defaultLayoutRule(`(^|/)kubernetes-manifests[^/]*$`, StaticClusterMonorepoLayout()),
+	defaultLayoutRule(`.*`, DefaultBusinessAppLayout()),
+}
+
+func defaultLayoutRule(match string, layoutConfig *types.LayoutConfig) types.LayoutRule {
+	return types.LayoutRule{Match: match, Layout: *layoutConfig, Pattern: regexp.MustCompile(match)}
+}
+
+// LoadLayoutRules reads and validates a layout rules file
+func LoadLayoutRules(path string) ([]types.LayoutRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout config: %w", err)
+	}
+
+	var file types.LayoutRulesFile
+	if err := decodeStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse layout config %s: %w", path, err)
+	}
+
+	if err := ValidateLayoutRules(file.Rules); err != nil {
+		return nil, fmt.Errorf("invalid layout config %s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+// ParseLayoutConfig parses and validates a single layout config,
+// e.g. one committed to a repository
+func ParseLayoutConfig(data []byte) (*types.LayoutConfig, error) {
+	var layoutConfig types.LayoutConfig
+	if err := decodeStrict(data, &layoutConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse layout config: %w", err)
+	}
+	if err := ValidateLayoutConfig(&layoutConfig); err != nil {
+		return nil, err
+	}
+	return &layoutConfig, nil
+}
+
+// decodeStrict decodes YAML rejecting misspelled keys instead of silently using defaults
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("file is empty")
+		}
+		return err
+	}
+	return nil
+}
+
+// ValidateLayoutRules checks the pattern and layout of every rule and stores
+// the compiled patterns in the rules
+func ValidateLayoutRules(rules []types.LayoutRule) error {
+	if len(rules) == 0 {
+		return errors.New("no rules defined")
+	}
+
+	var errs []error
+	for i, rule := range rules {
+		if rule.Match == "" {
+			errs = append(errs, fmt.Errorf("rule %d: match is required", i))
+		} else if re, err := regexp.Compile(rule.Match); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: invalid match pattern: %w", i, err))
+		} else {
+			rules[i].Pattern = re
+		}
+		if err := ValidateLayoutConfig(&rule.Layout); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d (%s): %w", i, rule.Match, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateLayoutConfig checks that a layout config can resolve paths
+func ValidateLayoutConfig(layoutConfig *types.LayoutConfig) error {
+	// Compiles the path template, if any
+	if _, err := layout.NewResolver(layoutConfig); err != nil {
+		return err
+	}
+
+	// Placeholders of a template can stand in for the cluster and env resolvers
+	var template *layout.PathTemplate
+	if layoutConfig.PathStructure.Template != "" {
+		template, _ = layout.CompilePathTemplate(layoutConfig.PathStructure.Template)
+	}
+	captures := func(name string) bool {
+		return template != nil && template.Has(name)
 	}
 
-	// Check for monorepo pattern: kubernetes-manifests
-	if strings.HasPrefix(repoName, "kubernetes-manifests") || repoName == "kubernetes-manifests" {
-		return DefaultMonorepoLayout()
+	var errs []error
+	switch layoutConfig.Strategy {
+	case types.LayoutMonorepo:
+		cluster := layoutConfig.ClusterResolver
+		if cluster.Static == nil && cluster.FromPathIndex == nil && !captures("cluster") {
+			errs = append(errs, errors.New("monorepo layout needs clusterResolver.static, clusterResolver.fromPathIndex or a {cluster} template placeholder"))
+		}
+		if cluster.FromPathIndex != nil && *cluster.FromPathIndex < 0 {
+			errs = append(errs, errors.New("clusterResolver.fromPathIndex must not be negative"))
+		}
+		errs = append(errs, validatePathStructure(layoutConfig.PathStructure)...)
+	case types.LayoutSplitByEnv:
+		// Repo name patterns are checked by NewSplitByEnvResolver above
+		errs = append(errs, validatePathStructure(layoutConfig.PathStructure)...)
 	}
+	return errors.Join(errs...)
+}
 
-	// Default to business app layout for other repos
-	return DefaultBusinessAppLayout()
+// validatePathStructure checks that path indexes are usable and distinct;
+// they are unused when a template is set
+func validatePathStructure(structure types.PathStructure) []error {
+	if structure.Template != "" {
+		return nil
+	}
+
+	var errs []error
+	for _, index := range []struct {
+		name  string
+		value int
+	}{
+		{"typeIndex", structure.TypeIndex},
+		{"namespaceIndex", structure.NamespaceIndex},
+		{"chartIndex", structure.ChartIndex},
+	} {
+		if index.value < 0 {
+			errs = append(errs, fmt.Errorf("pathStructure.%s must not be negative", index.name))
+		}
+	}
+	if structure.TypeIndex == structure.NamespaceIndex || structure.TypeIndex == structure.ChartIndex ||
+		structure.NamespaceIndex == structure.ChartIndex {
+		errs = append(errs, errors.New("pathStructure indexes must be distinct"))
+	}
+	return errs
 }
 
+// LayoutConfigForRepo returns the layout of the first matching rule. Patterns
+// containing a "/" match "<org>/<repo>", others the repo name alone, so
+// "^kubernetes-..." patterns keep working. Rules not compiled by
+// ValidateLayoutRules are compiled on each call.
+func LayoutConfigForRepo(rules []types.LayoutRule, org, repo string) (*types.LayoutConfig, error) {
+	fullName := repo
+	if org != "" {
+		fullName = org + "/" + repo
+	}
+
+	for _, rule := range rules {
+		subject := repo
+		if strings.Contains(rule.Match, "/") {
+			subject = fullName
+		}
+		re := rule.Pattern
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(rule.Match); err != nil {
+				return nil, fmt.Errorf("invalid layout rule pattern %q: %w", rule.Match, err)
+			}
+		}
+		if re.MatchString(subject) {
+			layoutConfig := rule.Layout
+			return &layoutConfig, nil
+		}
+	}
+	return nil, fmt.Errorf("no layout rule matches repository %s; add a rule (or a catch-all \".*\" rule) to the layout config", fullName)
+}
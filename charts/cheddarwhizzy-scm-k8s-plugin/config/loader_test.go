@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+func TestLayoutConfigForRepo(t *testing.T) {
+	rules := []types.LayoutRule{
+		{Match: "^acme/kubernetes-manifests$", Layout: *DefaultMonorepoLayout()},
+		{Match: "^kubernetes-[^-]+-.+$", Layout: *DefaultSplitByEnvLayout()},
+		{Match: "^legacy-", Layout: *DefaultBusinessAppLayout()},
+	}
+	if err := ValidateLayoutRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		org, repo string
+		want      types.LayoutStrategy // "" for no match
+	}{
+		{"acme", "kubernetes-manifests", types.LayoutMonorepo},
+		{"other", "kubernetes-manifests", ""},
+		// Patterns without a "/" match the repository name alone
+		{"acme", "kubernetes-prod-us-east-1", types.LayoutSplitByEnv},
+		{"acme", "legacy-shop", types.LayoutBusinessApp},
+		{"legacy-org", "shop", ""},
+	}
+	for _, tt := range tests {
+		layoutConfig, err := LayoutConfigForRepo(rules, tt.org, tt.repo)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s/%s: got %s, want no match", tt.org, tt.repo, layoutConfig.Strategy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s: %v", tt.org, tt.repo, err)
+		} else if layoutConfig.Strategy != tt.want {
+			t.Errorf("%s/%s: got %s, want %s", tt.org, tt.repo, layoutConfig.Strategy, tt.want)
+		}
+	}
+}
+
+func TestDefaultLayoutRules(t *testing.T) {
+	tests := []struct {
+		repo     string
+		registry bool
+		want     types.LayoutStrategy
+		static   bool
+	}{
+		{"kubernetes-prod-cluster1", false, types.LayoutSplitByEnv, false},
+		{"kubernetes-manifests", false, types.LayoutMonorepo, true},
+		{"kubernetes-manifests", true, types.LayoutMonorepo, false},
+		{"shop", false, types.LayoutBusinessApp, false},
+	}
+	for _, tt := range tests {
+		layoutConfig, err := LayoutConfigForRepo(DefaultLayoutRules(tt.registry), "acme", tt.repo)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.repo, err)
+		}
+		if layoutConfig.Strategy != tt.want || (layoutConfig.ClusterResolver.Static != nil) != tt.static {
+			t.Errorf("%s (registry %v): got %s with static cluster %v", tt.repo, tt.registry, layoutConfig.Strategy, layoutConfig.ClusterResolver.Static != nil)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// baseCharts reads the Chart.yaml of each base chart of a repo once for all
+// of its envs
+type baseCharts struct {
+	mu     sync.Mutex
+	charts map[string]*baseChart
+}
+
+type baseChart struct {
+	once     sync.Once
+	metadata *types.Chart
+	err      error
+}
+
+func newBaseCharts() *baseCharts {
+	return &baseCharts{charts: make(map[string]*baseChart)}
+}
+
+// get returns the Chart.yaml of deployment/k8s/base/<chart>. A missing or
+// invalid Chart.yaml (usually a deleted or renamed base chart) is logged and
+// returns nil: the parameters are informational and ArgoCD reports the
+// broken chart itself. Only upstream errors are returned.
+func (b *baseCharts) get(ctx context.Context, req *request, org, repo, chart string) (*types.Chart, error) {
+	b.mu.Lock()
+	entry, ok := b.charts[chart]
+	if !ok {
+		entry = &baseChart{}
+		b.charts[chart] = entry
+	}
+	b.mu.Unlock()
+
+	entry.once.Do(func() {
+		chartFile := fmt.Sprintf("deployment/k8s/base/%s/Chart.yaml", chart)
+		data, err := req.scm.ReadFile(ctx, org, repo, req.branch, chartFile)
+		if scm.IsNotFound(err) {
+			log.Printf("Warning: %s/%s has no %s; was the base chart deleted or renamed?", org, repo, chartFile)
+			return
+		}
+		if err != nil {
+			entry.err = err
+			return
+		}
+		if entry.metadata, err = config.ParseChart(data); err != nil {
+			log.Printf("Warning: ignoring invalid %s in %s/%s: %v", chartFile, org, repo, err)
+		}
+	})
+	return entry.metadata, entry.err
+}
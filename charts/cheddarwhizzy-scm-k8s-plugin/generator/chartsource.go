@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// externalChart returns the external chart a chart directory declares in
+// chart-source.yaml or in the chartSource of its argocd-config.yaml, or nil
+// when the chart lives in the repository. files lists the directory.
+func (g *Generator) externalChart(ctx context.Context, req *request, org, repo, dir string, files map[string]bool, argocdConfig *types.ArgoCDConfig) (*types.ChartSource, error) {
+	invalid := func(file string, err error) error {
+		return &ValidationError{Repository: org + "/" + repo, Path: dir + "/" + file, Err: err}
+	}
+
+	declared := argocdConfig != nil && argocdConfig.ChartSource != nil
+	if !files[scm.ChartSourceFile] {
+		if !declared {
+			return nil, nil
+		}
+		if err := config.ValidateChartSource(argocdConfig.ChartSource); err != nil {
+			return nil, invalid("argocd-config.yaml", fmt.Errorf("chartSource: %w", err))
+		}
+		return argocdConfig.ChartSource, nil
+	}
+
+	if declared {
+		return nil, invalid(scm.ChartSourceFile, errors.New("the chart source is also declared in argocd-config.yaml"))
+	}
+	data, err := req.scm.ReadFile(ctx, org, repo, req.branch, dir+"/"+scm.ChartSourceFile)
+	if err != nil {
+		return nil, err
+	}
+	source, err := config.ParseChartSource(data)
+	if err != nil {
+		return nil, invalid(scm.ChartSourceFile, err)
+	}
+	return source, nil
+}
@@ -0,0 +1,19 @@
+package generator
+
+import "fmt"
+
+// ValidationError reports invalid configuration committed to a repository.
+// It is the repository owners' to fix, so handlers surface it to the caller.
+type ValidationError struct {
+	Repository string
+	Path       string
+	Err        error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s in %s: %v", e.Path, e.Repository, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,194 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Filter scopes select what a pattern is matched against
+const (
+	scopeRepo  = "repo"
+	scopeChart = "chart"
+	scopeEnv   = "env"
+)
+
+// pattern is one parsed include or exclude pattern:
+// "[repo:|chart:|env:]<glob>" or "[scope:]/<regex>/".
+// Unscoped patterns match the repository name; repo patterns containing
+// a "/" match "<org>/<repo>" instead.
+type pattern struct {
+	raw   string
+	scope string
+	glob  string
+	regex *regexp.Regexp
+	// filtered counts the candidates this (exclude) pattern removed
+	filtered int
+}
+
+// parsePattern parses and validates a pattern
+func parsePattern(raw string) (*pattern, error) {
+	p := &pattern{raw: raw, scope: scopeRepo}
+	expr := raw
+	for _, scope := range []string{scopeRepo, scopeChart, scopeEnv} {
+		if strings.HasPrefix(expr, scope+":") {
+			p.scope = scope
+			expr = strings.TrimPrefix(expr, scope+":")
+			break
+		}
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("empty pattern %q", raw)
+	}
+
+	if len(expr) > 1 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+		regex, err := regexp.Compile(expr[1 : len(expr)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in pattern %q: %w", raw, err)
+		}
+		p.regex = regex
+		return p, nil
+	}
+
+	if _, err := path.Match(expr, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob in pattern %q: %w", raw, err)
+	}
+	p.glob = expr
+	return p, nil
+}
+
+// matches reports whether the pattern matches a candidate named name in org
+func (p *pattern) matches(org, name string) bool {
+	subject := name
+	expr := p.glob
+	if p.regex != nil {
+		expr = p.regex.String()
+	}
+	if p.scope == scopeRepo && strings.Contains(expr, "/") {
+		subject = org + "/" + name
+	}
+
+	if p.regex != nil {
+		return p.regex.MatchString(subject)
+	}
+	matched, _ := path.Match(p.glob, subject)
+	return matched
+}
+
+// filter applies the include and exclude patterns of a request.
+// Within a scope a candidate must match one include pattern (if any are
+// given) and no exclude pattern.
+type filter struct {
+	mu       sync.Mutex
+	includes map[string][]*pattern
+	excludes map[string][]*pattern
+	// per scope: candidates seen and candidates rejected by the includes
+	candidates  map[string]int
+	notIncluded map[string]int
+}
+
+// newFilter parses include and exclude patterns
+func newFilter(includePatterns, excludePatterns []string) (*filter, error) {
+	f := &filter{
+		includes:    make(map[string][]*pattern),
+		excludes:    make(map[string][]*pattern),
+		candidates:  make(map[string]int),
+		notIncluded: make(map[string]int),
+	}
+	for _, raw := range includePatterns {
+		p, err := parsePattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid includePatterns: %w", err)
+		}
+		f.includes[p.scope] = append(f.includes[p.scope], p)
+	}
+	for _, raw := range excludePatterns {
+		p, err := parsePattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excludePatterns: %w", err)
+		}
+		f.excludes[p.scope] = append(f.excludes[p.scope], p)
+	}
+	return f, nil
+}
+
+// allow reports whether a candidate of scope passes the patterns
+func (f *filter) allow(scope, org, name string) bool {
+	if len(f.includes[scope]) == 0 && len(f.excludes[scope]) == 0 {
+		return true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.candidates[scope]++
+
+	if includes := f.includes[scope]; len(includes) > 0 {
+		included := false
+		for _, p := range includes {
+			if p.matches(org, name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			f.notIncluded[scope]++
+			return false
+		}
+	}
+
+	for _, p := range f.excludes[scope] {
+		if p.matches(org, name) {
+			p.filtered++
+			return false
+		}
+	}
+	return true
+}
+
+// allowEnvs returns the envs passing the env patterns
+func (f *filter) allowEnvs(envs []string) []string {
+	var allowed []string
+	for _, env := range envs {
+		if f.allow(scopeEnv, "", env) {
+			allowed = append(allowed, env)
+		}
+	}
+	return allowed
+}
+
+// allowCharts returns the charts passing the chart patterns
+func (f *filter) allowCharts(charts []string) []string {
+	var allowed []string
+	for _, chart := range charts {
+		if f.allow(scopeChart, "", chart) {
+			allowed = append(allowed, chart)
+		}
+	}
+	return allowed
+}
+
+// report logs how many candidates each pattern filtered
+func (f *filter) report() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, scope := range []string{scopeRepo, scopeEnv, scopeChart} {
+		if f.candidates[scope] == 0 {
+			continue
+		}
+		if includes := f.includes[scope]; len(includes) > 0 {
+			raw := make([]string, len(includes))
+			for i, p := range includes {
+				raw[i] = p.raw
+			}
+			log.Printf("Include patterns %v filtered %d of %d %s candidates", raw, f.notIncluded[scope], f.candidates[scope], scope)
+		}
+		for _, p := range f.excludes[scope] {
+			log.Printf("Exclude pattern %q filtered %d of %d %s candidates", p.raw, p.filtered, f.candidates[scope], scope)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package generator
+
+import "testing"
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		raw     string
+		scope   string
+		glob    string
+		regex   string
+		wantErr bool
+	}{
+		{raw: "shop-*", scope: scopeRepo, glob: "shop-*"},
+		{raw: "repo:acme/*", scope: scopeRepo, glob: "acme/*"},
+		{raw: "chart:api", scope: scopeChart, glob: "api"},
+		{raw: "env:prod-*", scope: scopeEnv, glob: "prod-*"},
+		{raw: "/^shop-(api|web)$/", scope: scopeRepo, regex: "^shop-(api|web)$"},
+		{raw: "env:/^(dev|qa)$/", scope: scopeEnv, regex: "^(dev|qa)$"},
+		// A single slash is a glob, not an empty regex
+		{raw: "/", scope: scopeRepo, glob: "/"},
+		// Unknown prefixes are part of the glob
+		{raw: "cluster:c1", scope: scopeRepo, glob: "cluster:c1"},
+		{raw: "", wantErr: true},
+		{raw: "chart:", wantErr: true},
+		{raw: "/shop-(/", wantErr: true},
+		{raw: "shop-[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			p, err := parsePattern(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.scope != tt.scope || p.glob != tt.glob {
+				t.Errorf("got scope %q glob %q, want scope %q glob %q", p.scope, p.glob, tt.scope, tt.glob)
+			}
+			regex := ""
+			if p.regex != nil {
+				regex = p.regex.String()
+			}
+			if regex != tt.regex {
+				t.Errorf("regex = %q, want %q", regex, tt.regex)
+			}
+		})
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		raw  string
+		org  string
+		name string
+		want bool
+	}{
+		{"shop-*", "acme", "shop-api", true},
+		{"shop-*", "acme", "billing", false},
+		// Without a slash the org is not part of the subject
+		{"acme*", "acme", "shop-api", false},
+		{"acme/*", "acme", "shop-api", true},
+		{"acme/*", "other", "shop-api", false},
+		{"*/shop-api", "other", "shop-api", true},
+		{"/^shop-/", "acme", "shop-api", true},
+		{"/^acme/shop-/", "acme", "shop-api", true},
+		{"/^acme/shop-/", "other", "shop-api", false},
+		// Regexes are unanchored unless anchored explicitly
+		{"/api/", "acme", "shop-api", true},
+		// Chart and env patterns never match against the org
+		{"chart:*/api", "acme", "api", false},
+		{"env:prod-*", "", "prod-eu", true},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern(tt.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.matches(tt.org, tt.name); got != tt.want {
+			t.Errorf("%q matches %s/%s = %v, want %v", tt.raw, tt.org, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterAllow(t *testing.T) {
+	f, err := newFilter(
+		[]string{"shop-*", "acme/billing", "env:prod-*"},
+		[]string{"*-legacy", "/-test$/", "chart:debug"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scope string
+		org   string
+		name  string
+		want  bool
+	}{
+		{scopeRepo, "acme", "shop-api", true},
+		{scopeRepo, "acme", "billing", true},
+		{scopeRepo, "other", "billing", false},    // not included
+		{scopeRepo, "acme", "shop-legacy", false}, // included, then excluded
+		{scopeRepo, "acme", "shop-test", false},   // included, then excluded
+		{scopeRepo, "acme", "search", false},      // not included
+		{scopeEnv, "", "prod-eu", true},
+		{scopeEnv, "", "dev", false},
+		{scopeChart, "", "api", true}, // no chart includes
+		{scopeChart, "", "debug", false},
+	}
+	for _, tt := range tests {
+		if got := f.allow(tt.scope, tt.org, tt.name); got != tt.want {
+			t.Errorf("allow(%s, %s/%s) = %v, want %v", tt.scope, tt.org, tt.name, got, tt.want)
+		}
+	}
+
+	// Counters reported per scope and per exclude pattern
+	for scope, want := range map[string][2]int{
+		scopeRepo:  {6, 2},
+		scopeEnv:   {2, 1},
+		scopeChart: {2, 0},
+	} {
+		if f.candidates[scope] != want[0] || f.notIncluded[scope] != want[1] {
+			t.Errorf("%s: candidates %d notIncluded %d, want %d and %d",
+				scope, f.candidates[scope], f.notIncluded[scope], want[0], want[1])
+		}
+	}
+	for _, p := range append(f.excludes[scopeRepo], f.excludes[scopeChart]...) {
+		if p.filtered != 1 {
+			t.Errorf("exclude %q filtered %d, want 1", p.raw, p.filtered)
+		}
+	}
+}
+
+func TestFilterWithoutPatterns(t *testing.T) {
+	f, err := newFilter(nil, []string{"repo:*-legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if envs := f.allowEnvs([]string{"dev", "prod"}); len(envs) != 2 {
+		t.Errorf("allowEnvs = %v, want every env", envs)
+	}
+	if !f.allow(scopeRepo, "acme", "shop-api") || f.allow(scopeRepo, "acme", "shop-legacy") {
+		t.Error("only shop-legacy should be excluded")
+	}
+	// Scopes without patterns are not counted
+	if f.candidates[scopeEnv] != 0 || f.candidates[scopeRepo] != 2 {
+		t.Errorf("candidates = %v, want 2 repo candidates only", f.candidates)
+	}
+
+	if _, err := newFilter([]string{"env:"}, nil); err == nil {
+		t.Error("expected an error for an invalid include pattern")
+	}
+	if _, err := newFilter(nil, []string{"/(/"}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
@@ -2,76 +2,196 @@ package generator
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
-	ghclient "github.com/cheddarwhizzy/argocd-scm-k8s-plugin/github"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/layout"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/pool"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/utils"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // Generator generates ApplicationSet parameters
 type Generator struct {
 	config      *types.Config
-	github      *ghclient.Client
-	layoutCache map[string]layout.Resolver // Cache resolvers per repo
+	providers   map[string]scm.Provider
+	layoutMu    sync.Mutex
+	layoutCache map[string]layout.Resolver // Cache resolvers per layout config fingerprint
+	guard       *deletionGuard
 }
 
-// NewGenerator creates a new generator
-func NewGenerator(cfg *types.Config, githubClient *ghclient.Client) *Generator {
+// NewGenerator creates a new generator serving the given SCM providers
+func NewGenerator(cfg *types.Config, providers ...scm.Provider) *Generator {
+	providerMap := make(map[string]scm.Provider, len(providers))
+	for _, provider := range providers {
+		providerMap[provider.Name()] = provider
+	}
+
 	return &Generator{
 		config:      cfg,
-		github:      githubClient,
+		providers:   providerMap,
 		layoutCache: make(map[string]layout.Resolver),
+		guard:       newDeletionGuard(cfg.MaxDeletionPercent, cfg.MaxDeletionCount, cfg.MinDeletionBaseline, cfg.DeletionAcceptAfter),
 	}
 }
 
-// GenerateParameters generates parameters based on input
-func (g *Generator) GenerateParameters(params struct {
-	Orgs            []string `json:"orgs,omitempty"`
-	URL             string   `json:"url,omitempty"`
-	Repository      string   `json:"repository,omitempty"`
-	Organization    string   `json:"organization,omitempty"`
-	Path            string   `json:"path,omitempty"`
-	RepoURL         string   `json:"repoURL,omitempty"`
-	Envs            []string `json:"envs"`
-	IncludePatterns []string `json:"includePatterns,omitempty"`
-	Branch          string   `json:"branch,omitempty"`
-}) ([]types.Parameter, error) {
-	branch := params.Branch
-	if branch == "" {
-		branch = g.config.DefaultBranch
-	}
-
-	ctx := context.Background()
+// repoLayoutFile is the path of the layout a repository may commit to override the layout rules
+const repoLayoutFile = ".argocd/layout.yaml"
+
+// valuesRef is the ref name of the values source of multi-source Applications
+const valuesRef = "values"
+
+// request holds the per-request settings shared by all generation modes
+type request struct {
+	scm         scm.Provider
+	branch      string
+	envs        []string
+	strict      bool
+	parallelism int
+	multiSource bool
+	filter      *filter
+	repoFilter  scm.RepoFilter
+}
+
+// GenerateParameters generates parameters based on input.
+// Cancelling ctx stops all in-flight SCM calls and returns its error.
+func (g *Generator) GenerateParameters(ctx context.Context, params types.PluginParameters) ([]types.Parameter, error) {
+	req := &request{
+		branch:      params.Branch,
+		envs:        params.Envs,
+		strict:      g.config.StrictMode,
+		parallelism: g.config.Parallelism,
+		multiSource: params.MultiSource,
+	}
+	if req.branch == "" {
+		req.branch = g.config.DefaultBranch
+	}
+	if params.Strict != nil {
+		req.strict = *params.Strict
+	}
+	// A request may lower, but not raise, the configured parallelism
+	if params.Parallelism > 0 && (req.parallelism < 1 || params.Parallelism < req.parallelism) {
+		req.parallelism = params.Parallelism
+	}
+
+	providerName := params.Provider
+	if providerName == "" {
+		providerName = g.config.DefaultProvider
+	}
+	var err error
+	provider, exists := g.providers[providerName]
+	if !exists {
+		return nil, fmt.Errorf("SCM provider %q is not configured", providerName)
+	}
+	req.scm = provider
+
+	req.filter, err = newFilter(params.IncludePatterns, params.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	req.repoFilter, err = newRepoFilter(params)
+	if err != nil {
+		return nil, err
+	}
+	// Discovery skips repos excluded by name before probing them
+	req.repoFilter.Name = func(org, repo string) bool {
+		return req.filter.allow(scopeRepo, org, repo)
+	}
+
+	// Repos, envs and charts of this request share one bound on concurrency
+	ctx = pool.WithLimiter(ctx, pool.NewLimiter(req.parallelism))
+
+	parameters, err := g.generate(ctx, req, params)
+	if err != nil {
+		return nil, err
+	}
+	req.filter.report()
+	// Never serve (or remember) a result cut short by cancellation
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Hold back results that would prune too many Applications at once
+	return g.guard.check(requestFingerprint(params), parameters, params.AllowDeletions), nil
+}
 
+// generate dispatches the request to the matching generation mode
+func (g *Generator) generate(ctx context.Context, req *request, params types.PluginParameters) ([]types.Parameter, error) {
 	// Determine mode: path mode (git directory generator), matrix mode (scmProvider), or standalone mode
 	if params.Path != "" {
 		// Path mode: process path from git directory generator
-		return g.generatePathMode(ctx, params.Path, params.RepoURL, branch)
+		return g.generatePathMode(ctx, req, params.Path, params.RepoURL)
 	} else if params.URL != "" && params.Repository != "" && params.Organization != "" {
 		// Matrix mode: process the single repo provided by scmProvider
-		return g.generateMatrixMode(ctx, params.URL, params.Repository, params.Organization, params.Envs, branch)
+		req.envs = req.filter.allowEnvs(req.envs)
+		return g.generateMatrixMode(ctx, req, params.URL, params.Repository, params.Organization)
 	} else if len(params.Orgs) > 0 {
 		// Standalone mode: discover repos by organization
-		return g.generateStandaloneMode(ctx, params.Orgs, params.Envs, branch)
+		req.envs = req.filter.allowEnvs(req.envs)
+		return g.generateStandaloneMode(ctx, req, params.Orgs)
 	} else {
 		return nil, fmt.Errorf("either 'orgs' (standalone mode) or 'url'+'repository'+'organization' (matrix mode) or 'path' (path mode) must be provided")
 	}
 }
 
+// newRepoFilter builds the standalone mode repository filter from the input parameters
+func newRepoFilter(params types.PluginParameters) (scm.RepoFilter, error) {
+	repoFilter := scm.RepoFilter{
+		Topics:        params.Topics,
+		ExcludeTopics: params.ExcludeTopics,
+		Visibility:    params.Visibility,
+		Archived:      params.Archived,
+		Fork:          params.Fork,
+	}
+
+	switch strings.ToLower(params.Visibility) {
+	case "", "public", "private", "internal":
+	default:
+		return repoFilter, fmt.Errorf("invalid visibility %q: must be public, private or internal", params.Visibility)
+	}
+
+	if params.PushedWithin != "" {
+		age, err := utils.ParseDuration(params.PushedWithin)
+		if err != nil || age <= 0 {
+			return repoFilter, fmt.Errorf("invalid pushedWithin %q: must be a positive duration such as 90d or 720h", params.PushedWithin)
+		}
+		repoFilter.PushedAfter = time.Now().Add(-age)
+	}
+
+	return repoFilter, nil
+}
+
+// tolerate decides whether a failed upstream call can be skipped.
+// Missing files (404) are always tolerated; any other error is returned in
+// strict mode so ArgoCD keeps its previous state instead of pruning.
+func (g *Generator) tolerate(req *request, err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if req.strict && !scm.IsNotFound(err) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	log.Printf("Warning: %s: %v", msg, err)
+	return nil
+}
+
 // generatePathMode generates parameters for path mode (git directory generator)
-func (g *Generator) generatePathMode(ctx context.Context, path, repoURL, branch string) ([]types.Parameter, error) {
+func (g *Generator) generatePathMode(ctx context.Context, req *request, path, repoURL string) ([]types.Parameter, error) {
 	log.Printf("Path mode: processing path %s", path)
 
 	// Parse repo URL to get org/repo
 	var org, repo string
 	var err error
 	if repoURL != "" {
-		org, repo, err = utils.ParseRepoURL(repoURL)
+		org, repo, err = req.scm.ParseRepoURL(repoURL)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse repo URL: %w", err)
 		}
@@ -79,12 +199,15 @@ func (g *Generator) generatePathMode(ctx context.Context, path, repoURL, branch
 		// Default to kubernetes-manifests for backward compatibility
 		org = "cheddarwhizzy"
 		repo = "kubernetes-manifests"
-		repoURL = fmt.Sprintf("git@github.com:%s/%s.git", org, repo)
+		repoURL = req.scm.RepoURL(org, repo)
 	}
 
 	// Get layout config and resolver for this repo
-	layoutConfig := config.GetLayoutConfigForRepo(repo)
-	resolver, err := g.getResolver(repo, layoutConfig)
+	layoutConfig, err := g.layoutConfigFor(ctx, req, org, repo)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := g.getResolver(layoutConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get layout resolver: %w", err)
 	}
@@ -95,18 +218,26 @@ func (g *Generator) generatePathMode(ctx context.Context, path, repoURL, branch
 		return nil, fmt.Errorf("failed to resolve layout: %w", err)
 	}
 
+	if !req.filter.allow(scopeRepo, org, repo) || !req.filter.allow(scopeChart, org, resolved.Chart) ||
+		(resolved.Env != "" && !req.filter.allow(scopeEnv, org, resolved.Env)) {
+		log.Printf("Path %s filtered out by include/exclude patterns", path)
+		return []types.Parameter{}, nil
+	}
+
 	// Read argocd-config.yaml from chart directory
-	argocdConfig, err := g.github.ReadArgoCDConfig(ctx, org, repo, branch, path)
+	argocdConfig, err := req.scm.ReadArgoCDConfig(ctx, org, repo, req.branch, path)
 	if err != nil {
-		log.Printf("Warning: Failed to read argocd-config.yaml for %s: %v", path, err)
+		if err := g.tolerate(req, err, "failed to read argocd-config.yaml for %s", path); err != nil {
+			return nil, err
+		}
 		// Continue with empty config
 		argocdConfig = &types.ArgoCDConfig{}
 	}
 
-	// Determine destination name (use cluster name or default)
-	destinationName := resolved.Cluster
-	if destinationName == "" {
-		destinationName = "in-cluster"
+	// Map the cluster to its ArgoCD destination
+	destinationName, destinationServer, err := g.destinationFor(org, repo, path, resolved)
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate parameter with argocd config
@@ -115,31 +246,136 @@ func (g *Generator) generatePathMode(ctx context.Context, path, repoURL, branch
 		Repository:           repo,
 		Cluster:              resolved.Cluster,
 		DestinationName:      destinationName,
+		DestinationServer:    destinationServer,
 		URL:                  repoURL,
-		Branch:               branch,
+		Branch:               req.branch,
+		Env:                  resolved.Env,
 		Namespace:            resolved.Namespace,
 		ChartName:            resolved.Chart,
 		SyncOptions:          argocdConfig.SyncOptions,
 		SyncPolicy:           argocdConfig.SyncPolicy,
 		IgnoreDifferences:    argocdConfig.IgnoreDifferences,
 		RevisionHistoryLimit: argocdConfig.RevisionHistoryLimit,
+		Captures:             resolved.Captures,
+	}
+
+	// A chart from a Helm repository or OCI registry takes its values from this path
+	files, err := req.scm.ListChartFiles(ctx, org, repo, req.branch, path)
+	if err != nil {
+		if err := g.tolerate(req, err, "failed to list files in %s", path); err != nil {
+			return nil, err
+		}
+		files = make(map[string]bool)
+	}
+	external, err := g.externalChart(ctx, req, org, repo, path, files, argocdConfig)
+	if err != nil {
+		return nil, err
+	}
+	if external != nil {
+		param.SourceType = types.SourceTypeHelm
+		param.ChartSource = external
+		param.ValuesSource = &types.ValuesSource{RepoURL: repoURL, TargetRevision: req.branch, Ref: valuesRef}
+		param.ValueFiles = []string{}
+		if files["values.yaml"] {
+			param.ValueFiles = append(param.ValueFiles, fmt.Sprintf("$%s/%s/values.yaml", valuesRef, path))
+		}
 	}
 
 	return []types.Parameter{param}, nil
 }
 
+// destinationFor maps the cluster of a resolved path to its ArgoCD destination.
+// With a cluster registry, paths without a cluster, unknown clusters and
+// namespaces the cluster does not allow are rejected instead of deploying to
+// the wrong place.
+func (g *Generator) destinationFor(org, repo, path string, resolved *types.ResolvedLayout) (string, string, error) {
+	if g.config.Clusters == nil {
+		if resolved.Cluster == "" {
+			return "in-cluster", "", nil
+		}
+		return resolved.Cluster, "", nil
+	}
+	if resolved.Cluster == "" {
+		return "", "", &ValidationError{
+			Repository: org + "/" + repo,
+			Path:       path,
+			Err:        errors.New("the layout resolves no cluster for this path"),
+		}
+	}
+
+	c, err := g.config.Clusters.Lookup(resolved.Cluster)
+	if err != nil {
+		return "", "", &ValidationError{Repository: org + "/" + repo, Path: path, Err: err}
+	}
+	if !c.AllowsNamespace(resolved.Namespace) {
+		return "", "", &ValidationError{
+			Repository: org + "/" + repo,
+			Path:       path,
+			Err:        fmt.Errorf("namespace %q is not allowed on cluster %s", resolved.Namespace, c.Name),
+		}
+	}
+	return c.DestinationName, c.Server, nil
+}
+
 // generateMatrixMode generates parameters for matrix mode (scmProvider + plugin)
-func (g *Generator) generateMatrixMode(ctx context.Context, url, repository, organization string, envs []string, branch string) ([]types.Parameter, error) {
+func (g *Generator) generateMatrixMode(ctx context.Context, req *request, url, repository, organization string) ([]types.Parameter, error) {
 	log.Printf("Matrix mode: processing repo %s/%s from scmProvider", organization, repository)
 
-	org := organization
-	repo := repository
-	repoURL := url
+	if !req.filter.allow(scopeRepo, organization, repository) {
+		log.Printf("Repo %s/%s filtered out by include/exclude patterns", organization, repository)
+		return []types.Parameter{}, nil
+	}
+
+	return g.generateRepo(ctx, req, organization, repository, url)
+}
+
+// generateStandaloneMode generates parameters for standalone mode (discover repos by org)
+func (g *Generator) generateStandaloneMode(ctx context.Context, req *request, orgs []string) ([]types.Parameter, error) {
+	log.Printf("Standalone mode: discovering repos for orgs: %v", orgs)
 
-	// Read project-info.yaml using GitHub API
-	projectInfo, err := g.github.ReadProjectInfo(ctx, org, repo, branch)
+	// Discover repositories of all orgs using the SCM provider
+	orgRepos := make([][]scm.Repository, len(orgs))
+	err := pool.ForEach(ctx, len(orgs), func(ctx context.Context, i int) error {
+		repos, err := req.scm.DiscoverRepos(ctx, orgs[i], req.envs, g.config.DefaultBranch, req.repoFilter)
+		if err != nil {
+			if err := g.tolerate(req, err, "failed to discover repos for org %s", orgs[i]); err != nil {
+				return err
+			}
+		}
+		orgRepos[i] = repos
+		return nil
+	})
 	if err != nil {
-		log.Printf("Warning: Failed to read project-info.yaml for %s: %v", repoURL, err)
+		return nil, err
+	}
+
+	var repos []scm.Repository
+	for _, discovered := range orgRepos {
+		repos = append(repos, discovered...)
+	}
+
+	// Results are collected by index so the output order matches discovery order
+	repoParameters := make([][]types.Parameter, len(repos))
+	err = pool.ForEach(ctx, len(repos), func(ctx context.Context, i int) error {
+		parameters, err := g.generateRepo(ctx, req, repos[i].Owner, repos[i].Name, repos[i].URL)
+		repoParameters[i] = parameters
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return flatten(repoParameters), nil
+}
+
+// generateRepo generates parameters for every (env, chart, cluster) combination of a business app repo
+func (g *Generator) generateRepo(ctx context.Context, req *request, org, repo, repoURL string) ([]types.Parameter, error) {
+	// Read project-info.yaml using the SCM provider
+	projectInfo, err := req.scm.ReadProjectInfo(ctx, org, repo, req.branch)
+	if err != nil {
+		if err := g.tolerate(req, err, "failed to read project-info.yaml for %s", repoURL); err != nil {
+			return nil, err
+		}
 		// Continue with defaults
 		projectInfo = &types.ProjectInfo{}
 	}
@@ -150,200 +386,343 @@ func (g *Generator) generateMatrixMode(ctx context.Context, url, repository, org
 		namespace = strings.TrimSuffix(repo, ".git")
 	}
 
-	var allParameters []types.Parameter
+	// Envs usually deploy the same base charts
+	bases := newBaseCharts()
 
-	// For each environment
-	for _, env := range envs {
-		envPath := fmt.Sprintf("deployment/k8s/%s", env)
+	envParameters := make([][]types.Parameter, len(req.envs))
+	err = pool.ForEach(ctx, len(req.envs), func(ctx context.Context, i int) error {
+		parameters, err := g.generateEnv(ctx, req, org, repo, repoURL, namespace, projectInfo, bases, req.envs[i])
+		envParameters[i] = parameters
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Discover charts in this environment
-		charts, err := g.github.DiscoverCharts(ctx, org, repo, branch, envPath)
-		if err != nil {
-			log.Printf("Warning: Failed to discover charts for %s/%s: %v", repoURL, envPath, err)
-			continue
+	return flatten(envParameters), nil
+}
+
+// generateEnv generates parameters for every (chart, cluster) combination of one environment
+func (g *Generator) generateEnv(ctx context.Context, req *request, org, repo, repoURL, namespace string, projectInfo *types.ProjectInfo, bases *baseCharts, env string) ([]types.Parameter, error) {
+	envPath := fmt.Sprintf("deployment/k8s/%s", env)
+
+	// Get clusters for this environment
+	clusters, err := g.getClustersForEnv(projectInfo, env, namespace)
+	if err != nil {
+		err = &ValidationError{Repository: org + "/" + repo, Path: "project-info.yaml", Err: err}
+		return nil, g.tolerate(req, err, "skipping env %s of %s", env, repoURL)
+	}
+
+	// Discover charts in this environment
+	charts, err := req.scm.DiscoverCharts(ctx, org, repo, req.branch, envPath)
+	if err != nil {
+		if err := g.tolerate(req, err, "failed to discover charts for %s/%s", repoURL, envPath); err != nil {
+			return nil, err
 		}
+		// A listing error leaves no charts; a partial result is still usable
+		if charts == nil {
+			return nil, nil
+		}
+	}
 
-		// Get clusters for this environment
-		clusters := g.getClustersForEnv(projectInfo, env)
+	charts = req.filter.allowCharts(charts)
 
-		// For each chart
-		for _, chart := range charts {
-			// ChartPath points to base chart (where Chart.yaml lives)
-			chartPath := fmt.Sprintf("deployment/k8s/base/%s", chart)
+	// values-<cluster>.yaml and image-<cluster>.yaml of these are plugin files, not manifests
+	clusterNames := make([]string, len(clusters))
+	for i, cluster := range clusters {
+		clusterNames[i] = cluster.Name
+	}
 
-			// Get directory listing once for this chart to check for optional files
-			chartDirPath := fmt.Sprintf("%s/%s", envPath, chart)
-			chartFiles, err := g.github.ListChartFiles(ctx, org, repo, branch, chartDirPath)
-			if err != nil {
-				log.Printf("Warning: Failed to list files in %s/%s: %v", repoURL, chartDirPath, err)
-				chartFiles = make(map[string]bool)
+	// Get directory listing once per chart to check for optional files
+	chartFiles := make([]map[string]bool, len(charts))
+	externalCharts := make([]*types.ChartSource, len(charts))
+	// Chart.yaml of the base chart of in-repository Helm charts
+	chartMetadata := make([]*types.Chart, len(charts))
+	// image.yaml and image-<cluster>.yaml of Helm charts, keyed by file name
+	chartImages := make([]map[string]*types.Image, len(charts))
+	// Whether the base directory has values.yaml, looked up for external charts only
+	baseValues := make([]bool, len(charts))
+	skip := make([]bool, len(charts))
+	err = pool.ForEach(ctx, len(charts), func(ctx context.Context, i int) error {
+		chartDirPath := fmt.Sprintf("%s/%s", envPath, charts[i])
+		files, err := req.scm.ListChartFiles(ctx, org, repo, req.branch, chartDirPath)
+		if err != nil {
+			if err := g.tolerate(req, err, "failed to list files in %s/%s", repoURL, chartDirPath); err != nil {
+				return err
 			}
+			files = make(map[string]bool)
+		}
+		chartFiles[i] = files
+		baseValues[i] = true
 
-			// For each cluster
-			for _, cluster := range clusters {
-				valueFiles := g.buildValueFiles(env, chart, cluster.Name, chartFiles)
-
-				applicationName := utils.GenerateApplicationName(repo, chart, cluster.Name)
-
-				param := types.Parameter{
-					Organization:    org,
-					Repository:      repo,
-					URL:             repoURL,
-					Branch:          branch,
-					Env:             env,
-					ChartName:       chart,
-					ChartPath:       chartPath,
-					Cluster:         cluster.Name,
-					DestinationName: cluster.DestinationName,
-					Namespace:       namespace,
-					ValueFiles:      valueFiles,
-					ApplicationName: applicationName,
+		if scm.SourceType(files, clusterNames...) != types.SourceTypeHelm {
+			return nil
+		}
+		chartImages[i] = g.readImages(ctx, req, org, repo, chartDirPath, files, clusterNames)
+		var argocdConfig *types.ArgoCDConfig
+		if files["argocd-config.yaml"] {
+			argocdConfig, err = req.scm.ReadArgoCDConfig(ctx, org, repo, req.branch, chartDirPath)
+			if err != nil {
+				if err := g.tolerate(req, err, "failed to read argocd-config.yaml for %s/%s", repoURL, chartDirPath); err != nil {
+					return err
 				}
-
-				allParameters = append(allParameters, param)
+				// Continue with empty config
+				argocdConfig = nil
+			}
+		}
+		externalCharts[i], err = g.externalChart(ctx, req, org, repo, chartDirPath, files, argocdConfig)
+		if err != nil {
+			skip[i] = true
+			return g.tolerate(req, err, "skipping chart %s/%s", repoURL, chartDirPath)
+		}
+		if externalCharts[i] != nil {
+			// External charts need no base directory
+			baseFiles, err := req.scm.ListChartFiles(ctx, org, repo, req.branch, "deployment/k8s/base/"+charts[i])
+			if err != nil && !scm.IsNotFound(err) {
+				skip[i] = true
+				return g.tolerate(req, err, "failed to list files in %s/deployment/k8s/base/%s", repoURL, charts[i])
 			}
+			baseValues[i] = baseFiles["values.yaml"]
+			return nil
+		}
+		chartMetadata[i], err = bases.get(ctx, req, org, repo, charts[i])
+		if err != nil {
+			return g.tolerate(req, err, "failed to read Chart.yaml of %s/deployment/k8s/base/%s", repoURL, charts[i])
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return allParameters, nil
-}
-
-// generateStandaloneMode generates parameters for standalone mode (discover repos by org)
-func (g *Generator) generateStandaloneMode(ctx context.Context, orgs, envs []string, branch string) ([]types.Parameter, error) {
-	log.Printf("Standalone mode: discovering repos for orgs: %v", orgs)
-
 	var allParameters []types.Parameter
 
-	// For each organization
-	for _, org := range orgs {
-		// Discover repositories using GitHub API
-		repos, err := g.github.DiscoverRepos(ctx, org, envs, g.config.DefaultBranch)
-		if err != nil {
-			log.Printf("Warning: Failed to discover repos for org %s: %v", org, err)
+	// For each chart
+	for i, chart := range charts {
+		if skip[i] {
+			continue
+		}
+		// Helm charts are deployed from the base chart (where Chart.yaml lives),
+		// everything else from the env directory itself
+		chartPath := fmt.Sprintf("%s/%s", envPath, chart)
+		sourceType := scm.SourceType(chartFiles[i], clusterNames...)
+		directoryExclude := ""
+		if sourceType == "" && len(chartFiles[i]) == 0 {
+			// The listing failed, fall back to the Helm layout
+			sourceType = types.SourceTypeHelm
+		}
+		switch sourceType {
+		case types.SourceTypeHelm:
+			chartPath = fmt.Sprintf("deployment/k8s/base/%s", chart)
+		case types.SourceTypeDirectory, types.SourceTypeJsonnet:
+			// Plain manifests without the plugin's own files
+			directoryExclude = scm.ExcludeGlob(chartFiles[i], clusterNames)
+		case "":
+			// Only files of the env's clusters, e.g. a leftover values-<cluster>.yaml
+			log.Printf("Skipping %s/%s/%s: no app for the clusters of env %s", repoURL, envPath, chart, env)
 			continue
 		}
 
-		// For each repository
-		for _, repo := range repos {
-			repoURL := fmt.Sprintf("git@github.com:%s/%s.git", org, repo)
-
-			// Read project-info.yaml using GitHub API
-			projectInfo, err := g.github.ReadProjectInfo(ctx, org, repo, branch)
-			if err != nil {
-				log.Printf("Warning: Failed to read project-info.yaml for %s: %v", repoURL, err)
-				projectInfo = &types.ProjectInfo{}
+		// For each cluster
+		for _, cluster := range clusters {
+			valueFiles := []string{}
+			// Value files of an external chart can only be read through the $values ref
+			multiSource := req.multiSource || externalCharts[i] != nil
+			if sourceType == types.SourceTypeHelm {
+				valueFiles = g.buildValueFiles(env, chart, cluster.Name, chartFiles[i], multiSource, baseValues[i])
 			}
 
-			// Determine namespace
-			namespace := projectInfo.Deployment.Namespace
-			if namespace == "" {
-				namespace = strings.TrimSuffix(repo, ".git")
+			applicationName := utils.GenerateApplicationName(repo, chart, cluster.Name)
+
+			param := types.Parameter{
+				Organization:      org,
+				Repository:        repo,
+				URL:               repoURL,
+				Branch:            req.branch,
+				Env:               env,
+				ChartName:         chart,
+				ChartPath:         chartPath,
+				SourceType:        sourceType,
+				DirectoryExclude:  directoryExclude,
+				Cluster:           cluster.Name,
+				DestinationName:   cluster.DestinationName,
+				DestinationServer: cluster.Server,
+				Namespace:         namespace,
+				ValueFiles:        valueFiles,
+				ApplicationName:   applicationName,
 			}
-
-			// For each environment
-			for _, env := range envs {
-				envPath := fmt.Sprintf("deployment/k8s/%s", env)
-
-				// Discover charts in this environment
-				charts, err := g.github.DiscoverCharts(ctx, org, repo, branch, envPath)
-				if err != nil {
-					log.Printf("Warning: Failed to discover charts for %s/%s: %v", repoURL, envPath, err)
-					continue
-				}
-
-				// Get clusters for this environment
-				clusters := g.getClustersForEnv(projectInfo, env)
-
-				// For each chart
-				for _, chart := range charts {
-					chartPath := fmt.Sprintf("deployment/k8s/base/%s", chart)
-
-					chartDirPath := fmt.Sprintf("%s/%s", envPath, chart)
-					chartFiles, err := g.github.ListChartFiles(ctx, org, repo, branch, chartDirPath)
-					if err != nil {
-						log.Printf("Warning: Failed to list files in %s/%s: %v", repoURL, chartDirPath, err)
-						chartFiles = make(map[string]bool)
-					}
-
-					// For each cluster
-					for _, cluster := range clusters {
-						valueFiles := g.buildValueFiles(env, chart, cluster.Name, chartFiles)
-
-						param := types.Parameter{
-							Organization:    org,
-							Repository:      repo,
-							URL:             repoURL,
-							Branch:          branch,
-							Env:             env,
-							ChartName:       chart,
-							ChartPath:       chartPath,
-							Cluster:         cluster.Name,
-							DestinationName: cluster.DestinationName,
-							Namespace:       namespace,
-							ValueFiles:      valueFiles,
-						}
-
-						allParameters = append(allParameters, param)
-					}
+			if multiSource && sourceType == types.SourceTypeHelm {
+				param.ChartSource = &types.ChartSource{RepoURL: repoURL, Path: chartPath, TargetRevision: req.branch}
+				if externalCharts[i] != nil {
+					param.ChartSource = externalCharts[i]
+					param.ChartPath = ""
 				}
+				param.ValuesSource = &types.ValuesSource{RepoURL: repoURL, TargetRevision: req.branch, Ref: valuesRef}
+			}
+			if metadata := chartMetadata[i]; metadata != nil {
+				param.ChartVersion = metadata.Version
+				param.AppVersion = metadata.AppVersion
+				param.Dependencies = metadata.Dependencies
 			}
+			image := effectiveImage(chartImages[i], cluster.Name)
+			param.ImageRepository = image.Repository
+			param.ImageTag = image.Tag
+
+			allParameters = append(allParameters, param)
 		}
 	}
 
 	return allParameters, nil
 }
 
-// buildValueFiles builds the ordered list of value files
-func (g *Generator) buildValueFiles(env, chart, clusterName string, chartFiles map[string]bool) []string {
+// flatten concatenates per-index results in order
+func flatten(results [][]types.Parameter) []types.Parameter {
+	var all []types.Parameter
+	for _, parameters := range results {
+		all = append(all, parameters...)
+	}
+	return all
+}
+
+// buildValueFiles builds the ordered list of value files.
+// Single source paths are relative to the base chart; multi-source paths are
+// read from the repository through the $values ref.
+func (g *Generator) buildValueFiles(env, chart, clusterName string, chartFiles map[string]bool, multiSource, baseValues bool) []string {
 	valueFiles := []string{}
 
-	// 1. Base chart values
-	valueFiles = append(valueFiles, "values.yaml")
+	baseValuesPath := "values.yaml"
+	envDir := fmt.Sprintf("../../%s/%s", env, chart)
+	if multiSource {
+		baseValuesPath = fmt.Sprintf("$%s/deployment/k8s/base/%s/values.yaml", valuesRef, chart)
+		envDir = fmt.Sprintf("$%s/deployment/k8s/%s/%s", valuesRef, env, chart)
+	}
+
+	// 1. Base chart values (external charts may have none in the repository)
+	if baseValues {
+		valueFiles = append(valueFiles, baseValuesPath)
+	}
 
-	// 2. Env-specific values
-	envValuesPath := fmt.Sprintf("../../%s/%s/values.yaml", env, chart)
-	valueFiles = append(valueFiles, envValuesPath)
+	// 2. Env-specific values (an external chart may only have chart-source.yaml)
+	if chartFiles["values.yaml"] {
+		valueFiles = append(valueFiles, envDir+"/values.yaml")
+	}
 
 	// 3. Env-specific image.yaml (optional)
 	if chartFiles["image.yaml"] {
-		envImagePath := fmt.Sprintf("../../%s/%s/image.yaml", env, chart)
-		valueFiles = append(valueFiles, envImagePath)
+		valueFiles = append(valueFiles, envDir+"/image.yaml")
 	}
 
 	// 4. Cluster-specific values override (optional)
 	clusterValuesFile := fmt.Sprintf("values-%s.yaml", clusterName)
 	if chartFiles[clusterValuesFile] {
-		clusterValuesPath := fmt.Sprintf("../../%s/%s/%s", env, chart, clusterValuesFile)
-		valueFiles = append(valueFiles, clusterValuesPath)
+		valueFiles = append(valueFiles, envDir+"/"+clusterValuesFile)
 	}
 
 	// 5. Cluster-specific image.yaml override (optional)
 	clusterImageFile := fmt.Sprintf("image-%s.yaml", clusterName)
 	if chartFiles[clusterImageFile] {
-		clusterImagePath := fmt.Sprintf("../../%s/%s/%s", env, chart, clusterImageFile)
-		valueFiles = append(valueFiles, clusterImagePath)
+		valueFiles = append(valueFiles, envDir+"/"+clusterImageFile)
 	}
 
 	return valueFiles
 }
 
-// getClustersForEnv returns clusters for an environment, with fallback to defaults
-func (g *Generator) getClustersForEnv(projectInfo *types.ProjectInfo, env string) []types.ClusterConfig {
-	if projectInfo.Deployment.Environments == nil {
-		return g.config.DefaultClusters
+// getClustersForEnv returns the clusters listed for an environment plus the
+// registry clusters matching its selector, with fallback to defaults
+func (g *Generator) getClustersForEnv(projectInfo *types.ProjectInfo, env, namespace string) ([]types.ClusterConfig, error) {
+	envConfig := projectInfo.Deployment.Environments[env]
+	if len(envConfig.Clusters) == 0 && envConfig.ClusterSelector == "" {
+		if g.config.DefaultClusterSelector != nil && g.config.Clusters != nil {
+			return g.selectClusters(env, namespace, g.config.DefaultClusterSelector, nil), nil
+		}
+		return g.config.DefaultClusters, nil
 	}
 
-	envConfig, exists := projectInfo.Deployment.Environments[env]
-	if !exists || len(envConfig.Clusters) == 0 {
-		return g.config.DefaultClusters
+	clusters := envConfig.Clusters
+	if envConfig.ClusterSelector != "" {
+		if g.config.Clusters == nil {
+			return nil, fmt.Errorf("clusterSelector of env %s needs a cluster registry", env)
+		}
+		selector, err := labels.Parse(envConfig.ClusterSelector)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: invalid cluster selector %q: %w", env, envConfig.ClusterSelector, err)
+		}
+		clusters = append(clusters[:len(clusters):len(clusters)], g.selectClusters(env, namespace, selector, clusters)...)
+	}
+	return clusters, nil
+}
+
+// selectClusters returns the registry clusters of env matching selector
+// that allow namespace, skipping clusters already listed
+func (g *Generator) selectClusters(env, namespace string, selector labels.Selector, listed []types.ClusterConfig) []types.ClusterConfig {
+	matched := g.config.Clusters.Select(env, selector)
+	if len(matched) == 0 {
+		// Usually a typo in the selector or env; every Application it selected before is removed
+		log.Printf("Warning: cluster selector %q matches no registered cluster of env %s", selector, env)
 	}
 
-	return envConfig.Clusters
+	var selected []types.ClusterConfig
+	for _, c := range matched {
+		if containsCluster(listed, c.Name) {
+			continue
+		}
+		if !c.AllowsNamespace(namespace) {
+			log.Printf("Warning: cluster %s matches selector %q but does not allow namespace %s, skipping", c.Name, selector, namespace)
+			continue
+		}
+		selected = append(selected, types.ClusterConfig{Name: c.Name, DestinationName: c.DestinationName, Server: c.Server})
+	}
+	return selected
 }
 
-// getResolver gets or creates a resolver for a repo
-func (g *Generator) getResolver(repoName string, layoutConfig *types.LayoutConfig) (layout.Resolver, error) {
-	if resolver, exists := g.layoutCache[repoName]; exists {
+// containsCluster reports whether clusters contains a cluster named name
+func containsCluster(clusters []types.ClusterConfig, name string) bool {
+	for _, c := range clusters {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutConfigFor returns the layout committed to the repository as
+// .argocd/layout.yaml, falling back to the configured layout rules
+func (g *Generator) layoutConfigFor(ctx context.Context, req *request, org, repo string) (*types.LayoutConfig, error) {
+	data, err := req.scm.ReadFile(ctx, org, repo, req.branch, repoLayoutFile)
+	if err == nil {
+		layoutConfig, err := config.ParseLayoutConfig(data)
+		if err != nil {
+			return nil, &ValidationError{Repository: org + "/" + repo, Path: repoLayoutFile, Err: err}
+		}
+		log.Printf("Using layout %s from %s in %s/%s", layoutConfig.Strategy, repoLayoutFile, org, repo)
+		return layoutConfig, nil
+	}
+	if !scm.IsNotFound(err) {
+		if err := g.tolerate(req, err, "failed to read %s for %s/%s", repoLayoutFile, org, repo); err != nil {
+			return nil, err
+		}
+	}
+
+	rules := g.config.LayoutRules
+	if rules == nil {
+		rules = config.DefaultLayoutRules(g.config.Clusters != nil)
+	}
+	return config.LayoutConfigForRepo(rules, org, repo)
+}
+
+// getResolver gets or creates a resolver for a layout config.
+// Resolvers are cached by config content, so an edited repo layout file
+// gets a new resolver while unchanged ones are shared.
+func (g *Generator) getResolver(layoutConfig *types.LayoutConfig) (layout.Resolver, error) {
+	key, err := layoutFingerprint(layoutConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	g.layoutMu.Lock()
+	defer g.layoutMu.Unlock()
+
+	if resolver, exists := g.layoutCache[key]; exists {
 		return resolver, nil
 	}
 
@@ -352,7 +731,25 @@ func (g *Generator) getResolver(repoName string, layoutConfig *types.LayoutConfi
 		return nil, err
 	}
 
-	g.layoutCache[repoName] = resolver
+	g.layoutCache[key] = resolver
 	return resolver, nil
 }
 
+// layoutFingerprint hashes a layout config
+func layoutFingerprint(layoutConfig *types.LayoutConfig) (string, error) {
+	data, err := json.Marshal(layoutConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint layout config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Invalidate drops data cached by the SCM providers for a repository at ref
+func (g *Generator) Invalidate(owner, repo, ref string) {
+	for _, provider := range g.providers {
+		if invalidator, ok := provider.(scm.Invalidator); ok {
+			invalidator.Invalidate(owner, repo, ref)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/cluster"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/local"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// writeRepo commits files to a new repository <root>/<org>/<repo> on branch main
+func writeRepo(t *testing.T, root, org, repo string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, org, repo)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "fixture"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+}
+
+// newTestGenerator serves the repositories under root through the local provider
+func newTestGenerator(t *testing.T, root string, strict bool) *Generator {
+	t.Helper()
+	client, err := local.NewClient(root, "https://git.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGenerator(&types.Config{
+		DefaultProvider: "local",
+		DefaultBranch:   "main",
+		StrictMode:      strict,
+		Parallelism:     4,
+		DefaultClusters: []types.ClusterConfig{
+			{Name: "c1", DestinationName: "c1"},
+			{Name: "c2", DestinationName: "c2"},
+		},
+	}, client)
+}
+
+// byApplication indexes parameters by application name
+func byApplication(parameters []types.Parameter) map[string]types.Parameter {
+	apps := make(map[string]types.Parameter, len(parameters))
+	for _, param := range parameters {
+		apps[param.ApplicationName] = param
+	}
+	return apps
+}
+
+// generateBusinessApp generates the prod env of a business app repo acme/shop
+// holding files, on the clusters c1 and c2
+func generateBusinessApp(t *testing.T, files map[string]string) map[string]types.Parameter {
+	t.Helper()
+	root := t.TempDir()
+	files["project-info.yaml"] = "deployment: {namespace: shop}\n"
+	writeRepo(t, root, "acme", "shop", files)
+
+	g := newTestGenerator(t, root, true)
+	parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Organization: "acme",
+		Repository:   "shop",
+		URL:          "https://git.example.com/acme/shop.git",
+		Envs:         []string{"prod"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	return byApplication(parameters)
+}
+
+func TestGenerateHelmChart(t *testing.T) {
+	apps := generateBusinessApp(t, map[string]string{
+		"deployment/k8s/base/api/values.yaml":    "replicas: 1\n",
+		"deployment/k8s/prod/api/values.yaml":    "replicas: 2\n",
+		"deployment/k8s/prod/api/values-c2.yaml": "replicas: 3\n",
+	})
+	if len(apps) != 2 {
+		t.Fatalf("got %d applications, want api on two clusters: %v", len(apps), apps)
+	}
+
+	api := apps["shop-api-c2"]
+	if api.SourceType != types.SourceTypeHelm || api.ChartPath != "deployment/k8s/base/api" || api.Namespace != "shop" {
+		t.Errorf("api: unexpected source %q, path %q, namespace %q", api.SourceType, api.ChartPath, api.Namespace)
+	}
+	wantValueFiles := []string{
+		"values.yaml",
+		"../../prod/api/values.yaml",
+		"../../prod/api/values-c2.yaml",
+	}
+	if !reflect.DeepEqual(api.ValueFiles, wantValueFiles) {
+		t.Errorf("api valueFiles = %v, want %v", api.ValueFiles, wantValueFiles)
+	}
+	if files := apps["shop-api-c1"].ValueFiles; len(files) != 2 {
+		t.Errorf("api valueFiles on c1 = %v, want no c2 overrides", files)
+	}
+}
+
+func TestGenerateKustomizeOverlay(t *testing.T) {
+	apps := generateBusinessApp(t, map[string]string{
+		"deployment/k8s/prod/web/kustomization.yaml": "resources: [deployment.yaml]\n",
+		"deployment/k8s/prod/web/deployment.yaml":    "kind: Deployment\n",
+		// An overlay is deployed as is, even next to a base chart
+		"deployment/k8s/base/admin/values.yaml":        "replicas: 1\n",
+		"deployment/k8s/prod/admin/kustomization.yaml": "resources: [../../base/admin]\n",
+	})
+	if len(apps) != 4 {
+		t.Fatalf("got %d applications, want web and admin on two clusters: %v", len(apps), apps)
+	}
+
+	for _, name := range []string{"shop-web-c1", "shop-admin-c2"} {
+		app := apps[name]
+		if app.SourceType != types.SourceTypeKustomize || len(app.ValueFiles) != 0 {
+			t.Errorf("%s: unexpected source %q, valueFiles %v", name, app.SourceType, app.ValueFiles)
+		}
+	}
+	if path := apps["shop-web-c1"].ChartPath; path != "deployment/k8s/prod/web" {
+		t.Errorf("web path = %q, want the overlay directory", path)
+	}
+}
+
+func TestGenerateDirectory(t *testing.T) {
+	apps := generateBusinessApp(t, map[string]string{
+		"deployment/k8s/prod/legacy/service.yaml":                "kind: Service\n",
+		"deployment/k8s/prod/legacy/values-c1.yaml":              "replicas: 3\n",
+		"deployment/k8s/prod/legacy/argocd-config.yaml":          "syncOptions: [CreateNamespace=true]\n",
+		"deployment/k8s/prod/puller/image-puller-daemonset.yaml": "kind: DaemonSet\n",
+		// Directories holding only plugin files are not deployed
+		"deployment/k8s/prod/leftover/values-c2.yaml": "replicas: 1\n",
+		"deployment/k8s/prod/stale/image.yaml":        "image: {tag: v1}\n",
+	})
+	if len(apps) != 4 {
+		t.Fatalf("got %d applications, want legacy and puller on two clusters: %v", len(apps), apps)
+	}
+
+	legacy := apps["shop-legacy-c1"]
+	if legacy.SourceType != types.SourceTypeDirectory || legacy.ChartPath != "deployment/k8s/prod/legacy" ||
+		legacy.DirectoryExclude != "{argocd-config.yaml,values-c1.yaml}" {
+		t.Errorf("legacy: unexpected source %q, path %q, exclude %q", legacy.SourceType, legacy.ChartPath, legacy.DirectoryExclude)
+	}
+	// Manifests named like plugin files are still deployed
+	puller := apps["shop-puller-c1"]
+	if puller.SourceType != types.SourceTypeDirectory || puller.DirectoryExclude != "" {
+		t.Errorf("puller: unexpected source %q, exclude %q", puller.SourceType, puller.DirectoryExclude)
+	}
+}
+
+func TestGenerateChartMetadata(t *testing.T) {
+	apps := generateBusinessApp(t, map[string]string{
+		"deployment/k8s/base/api/Chart.yaml":  "apiVersion: v2\nname: api\nversion: 1.4.2\nappVersion: 2.10\ndependencies:\n  - name: postgresql\n    version: 15.x.x\n",
+		"deployment/k8s/base/api/values.yaml": "replicas: 1\n",
+		"deployment/k8s/prod/api/values.yaml": "replicas: 2\n",
+	})
+
+	for _, name := range []string{"shop-api-c1", "shop-api-c2"} {
+		api := apps[name]
+		// appVersion stays a string even though YAML would read 2.10 as a number
+		if api.ChartVersion != "1.4.2" || api.AppVersion != "2.10" {
+			t.Errorf("%s chart version %q, appVersion %q", name, api.ChartVersion, api.AppVersion)
+		}
+		if len(api.Dependencies) != 1 || api.Dependencies[0].Name != "postgresql" || api.Dependencies[0].Version != "15.x.x" {
+			t.Errorf("%s dependencies = %v", name, api.Dependencies)
+		}
+	}
+}
+
+func TestGenerateImageParameters(t *testing.T) {
+	apps := generateBusinessApp(t, map[string]string{
+		"deployment/k8s/base/api/values.yaml":      "replicas: 1\n",
+		"deployment/k8s/prod/api/values.yaml":      "replicas: 2\n",
+		"deployment/k8s/prod/api/image.yaml":       "image:\n  repository: ghcr.io/acme/api\n  tag: v1.2.3\n",
+		"deployment/k8s/prod/api/image-c2.yaml":    "image:\n  tag: v1.3.0\n",
+		"deployment/k8s/prod/worker/values.yaml":   "replicas: 1\n",
+		"deployment/k8s/prod/worker/image.yaml":    "image: ghcr.io:5000/acme/worker:2.0@sha256:0123\n",
+		"deployment/k8s/prod/worker/image-c2.yaml": "image: [broken\n",
+	})
+	if len(apps) != 4 {
+		t.Fatalf("got %d applications, want api and worker on two clusters: %v", len(apps), apps)
+	}
+
+	// The cluster file overrides the tag and keeps the repository
+	if api := apps["shop-api-c2"]; api.ImageRepository != "ghcr.io/acme/api" || api.ImageTag != "v1.3.0" {
+		t.Errorf("api image on c2 = %s:%s, want ghcr.io/acme/api:v1.3.0", api.ImageRepository, api.ImageTag)
+	}
+	if api := apps["shop-api-c1"]; api.ImageRepository != "ghcr.io/acme/api" || api.ImageTag != "v1.2.3" {
+		t.Errorf("api image on c1 = %s:%s, want ghcr.io/acme/api:v1.2.3", api.ImageRepository, api.ImageTag)
+	}
+	wantValueFiles := []string{
+		"values.yaml",
+		"../../prod/api/values.yaml",
+		"../../prod/api/image.yaml",
+		"../../prod/api/image-c2.yaml",
+	}
+	if files := apps["shop-api-c2"].ValueFiles; !reflect.DeepEqual(files, wantValueFiles) {
+		t.Errorf("api valueFiles = %v, want %v", files, wantValueFiles)
+	}
+
+	// An image reference works as well, and a broken image file only loses the image
+	for _, name := range []string{"shop-worker-c1", "shop-worker-c2"} {
+		if worker := apps[name]; worker.ImageRepository != "ghcr.io:5000/acme/worker" || worker.ImageTag != "2.0" {
+			t.Errorf("%s image = %s:%s, want ghcr.io:5000/acme/worker:2.0", name, worker.ImageRepository, worker.ImageTag)
+		}
+	}
+}
+
+func TestGenerateMissingBaseChart(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "orders", map[string]string{
+		"deployment/k8s/prod/orders/values.yaml": "replicas: 2\n",
+	})
+
+	// A deleted base chart must not fail a strict request for every repo
+	g := newTestGenerator(t, root, true)
+	parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Organization: "acme",
+		Repository:   "orders",
+		URL:          "https://git.example.com/acme/orders.git",
+		Envs:         []string{"prod"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	if len(parameters) != 2 {
+		t.Fatalf("got %d parameters, want 2", len(parameters))
+	}
+	if parameters[0].ChartVersion != "" {
+		t.Errorf("chartVersion = %q without Chart.yaml", parameters[0].ChartVersion)
+	}
+}
+
+func TestGenerateInvalidArgoCDConfig(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "orders", map[string]string{
+		"deployment/k8s/base/orders/Chart.yaml":         "apiVersion: v2\nname: orders\nversion: 1.0.0\n",
+		"deployment/k8s/prod/orders/values.yaml":        "replicas: 2\n",
+		"deployment/k8s/prod/orders/argocd-config.yaml": "syncOptions: [unterminated\n",
+	})
+	params := types.PluginParameters{
+		Organization: "acme",
+		Repository:   "orders",
+		URL:          "https://git.example.com/acme/orders.git",
+		Envs:         []string{"prod"},
+	}
+
+	// A broken argocd-config.yaml must not drop (and prune) a deployed chart
+	parameters, err := newTestGenerator(t, root, false).GenerateParameters(context.Background(), params)
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	if len(parameters) != 2 {
+		t.Fatalf("got %d parameters, want 2", len(parameters))
+	}
+	if parameters[0].SyncOptions != nil {
+		t.Errorf("syncOptions = %v, want the defaults", parameters[0].SyncOptions)
+	}
+
+	if _, err := newTestGenerator(t, root, true).GenerateParameters(context.Background(), params); err == nil {
+		t.Error("strict mode: expected an error")
+	}
+}
+
+func TestGenerateExternalChart(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "cache", map[string]string{
+		"deployment/k8s/prod/redis/chart-source.yaml":  "repoURL: oci://registry-1.docker.io/bitnamicharts\nchart: redis\ntargetRevision: 19.6.4\n",
+		"deployment/k8s/prod/redis/values.yaml":        "replicas: 2\n",
+		"deployment/k8s/prod/broken/chart-source.yaml": "repoURL: ftp://example.com\nchart: a/b\ntargetRevision: 1.0.0\n",
+		"deployment/k8s/prod/valkey/chart-source.yaml": "repoURL: https://charts.example.com\nchart: valkey\ntargetRevision: 1.0.0\n",
+	})
+
+	g := newTestGenerator(t, root, false)
+	parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Organization: "acme",
+		Repository:   "cache",
+		URL:          "https://git.example.com/acme/cache.git",
+		Envs:         []string{"prod"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+
+	apps := byApplication(parameters)
+	if _, exists := apps["cache-broken-c1"]; exists {
+		t.Error("chart with an invalid chart-source.yaml was not skipped")
+	}
+	redis, exists := apps["cache-redis-c1"]
+	if !exists {
+		t.Fatalf("no redis application in %v", apps)
+	}
+	want := &types.ChartSource{RepoURL: "oci://registry-1.docker.io/bitnamicharts", Chart: "redis", TargetRevision: "19.6.4"}
+	if !reflect.DeepEqual(redis.ChartSource, want) {
+		t.Errorf("chartSource = %+v, want %+v", redis.ChartSource, want)
+	}
+	if redis.ValuesSource == nil || redis.ValuesSource.Ref != valuesRef {
+		t.Errorf("valuesSource = %+v", redis.ValuesSource)
+	}
+	if want := []string{"$values/deployment/k8s/prod/redis/values.yaml"}; !reflect.DeepEqual(redis.ValueFiles, want) {
+		t.Errorf("valueFiles = %v, want %v", redis.ValueFiles, want)
+	}
+	// Without values.yaml there is no value file to reference
+	if valkey := apps["cache-valkey-c1"]; valkey.ChartSource == nil || len(valkey.ValueFiles) != 0 {
+		t.Errorf("valkey: chartSource %+v, valueFiles %v", valkey.ChartSource, valkey.ValueFiles)
+	}
+}
+
+func TestGeneratePathMode(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "kubernetes-manifests", map[string]string{
+		"prod-east/infra/cnpg/pg/argocd-config.yaml": "syncOptions: [ServerSideApply=true]\n",
+		"prod-east/infra/cnpg/pg/cluster.yaml":       "kind: Cluster\n",
+	})
+
+	g := newTestGenerator(t, root, true)
+	parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Path:    "prod-east/infra/cnpg/pg",
+		RepoURL: "https://git.example.com/acme/kubernetes-manifests.git",
+	})
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	if len(parameters) != 1 {
+		t.Fatalf("got %d parameters, want 1", len(parameters))
+	}
+	// Without a cluster registry the built-in monorepo layout keeps deploying to in-cluster
+	param := parameters[0]
+	if param.Cluster != "in-cluster" || param.DestinationName != "in-cluster" || param.Namespace != "cnpg" || param.ChartName != "pg" {
+		t.Errorf("resolved cluster %q (destination %q), namespace %q, chart %q", param.Cluster, param.DestinationName, param.Namespace, param.ChartName)
+	}
+	if !reflect.DeepEqual(param.SyncOptions, []string{"ServerSideApply=true"}) {
+		t.Errorf("syncOptions = %v", param.SyncOptions)
+	}
+}
+
+func TestGenerateRejectsPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "shop", map[string]string{
+		"deployment/k8s/prod/api/values.yaml": "replicas: 2\n",
+	})
+
+	g := newTestGenerator(t, filepath.Join(root, "acme"), true)
+	for _, repoURL := range []string{
+		"https://git.example.com/../acme/shop.git",
+		"https://git.example.com/acme/../shop.git",
+		"https://git.example.com/../shop.git",
+	} {
+		_, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+			Path:    "deployment/k8s/prod/api",
+			RepoURL: repoURL,
+		})
+		if err == nil {
+			t.Errorf("%s: expected an error", repoURL)
+		}
+	}
+
+	_, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Orgs: []string{".."},
+		Envs: []string{"prod"},
+	})
+	if err == nil {
+		t.Error("org outside the root: expected an error")
+	}
+}
+
+func TestGeneratePathModeRegistry(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "kubernetes-manifests", map[string]string{
+		"prod-east/infra/cnpg/pg/cluster.yaml": "kind: Cluster\n",
+		"prod-west/infra/cnpg/pg/cluster.yaml": "kind: Cluster\n",
+	})
+	registry, err := cluster.NewRegistry([]cluster.Cluster{{Name: "prod-east", Server: "https://prod-east.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newTestGenerator(t, root, true)
+	g.config.Clusters = registry
+
+	generate := func(path string) ([]types.Parameter, error) {
+		return g.GenerateParameters(context.Background(), types.PluginParameters{
+			Path:    path,
+			RepoURL: "https://git.example.com/acme/kubernetes-manifests.git",
+		})
+	}
+
+	parameters, err := generate("prod-east/infra/cnpg/pg")
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	if param := parameters[0]; param.DestinationServer != "https://prod-east.example.com" || param.DestinationName != "" {
+		t.Errorf("destination = name %q, server %q", param.DestinationName, param.DestinationServer)
+	}
+
+	var validationErr *ValidationError
+	if _, err := generate("prod-west/infra/cnpg/pg"); !errors.As(err, &validationErr) {
+		t.Errorf("unregistered cluster: got %v, want a ValidationError", err)
+	}
+}
+
+func TestGenerateClusterSelector(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "billing", map[string]string{
+		"project-info.yaml": "deployment:\n  namespace: billing\n  environments:\n    prod:\n      clusterSelector: region in(us),tier!=edge\n",
+		"deployment/k8s/prod/billing/kustomization.yaml": "resources: []\n",
+	})
+	registry, err := cluster.NewRegistry([]cluster.Cluster{
+		{Name: "prod-us", Env: "prod", Labels: map[string]string{"region": "us"}},
+		{Name: "prod-us-edge", Env: "prod", Labels: map[string]string{"region": "us", "tier": "edge"}},
+		{Name: "prod-eu", Env: "prod", Labels: map[string]string{"region": "eu"}},
+		{Name: "qa-us", Env: "qa", Labels: map[string]string{"region": "us"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newTestGenerator(t, root, true)
+	g.config.Clusters = registry
+
+	parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+		Organization: "acme",
+		Repository:   "billing",
+		URL:          "https://git.example.com/acme/billing.git",
+		Envs:         []string{"prod"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateParameters: %v", err)
+	}
+	if len(parameters) != 1 || parameters[0].Cluster != "prod-us" {
+		t.Errorf("selected %+v, want only prod-us", parameters)
+	}
+}
+
+func TestGenerateExcludedReposAreNotProbed(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "shop", map[string]string{
+		"deployment/k8s/prod/api/values.yaml": "replicas: 2\n",
+	})
+	// A repository missing its tree object fails strict discovery when it is probed
+	writeRepo(t, root, "acme", "broken", map[string]string{
+		"deployment/k8s/prod/api/values.yaml": "replicas: 2\n",
+	})
+	broken := filepath.Join(root, "acme", "broken")
+	out, err := exec.Command("git", "-C", broken, "rev-parse", "main^{tree}").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := strings.TrimSpace(string(out))
+	if err := os.Remove(filepath.Join(broken, ".git", "objects", tree[:2], tree[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newTestGenerator(t, root, true)
+	params := types.PluginParameters{Orgs: []string{"acme"}, Envs: []string{"prod"}}
+	parameters, err := g.GenerateParameters(context.Background(), params)
+	if err == nil {
+		t.Fatalf("expected probing the broken repository to fail, got %d parameters", len(parameters))
+	}
+
+	params.ExcludePatterns = []string{"broken"}
+	parameters, err = g.GenerateParameters(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parameters) != 2 {
+		t.Errorf("got %d parameters, want the 2 clusters of acme/shop", len(parameters))
+	}
+}
+
+// failingProvider serves a local repository but fails reading project-info.yaml
+type failingProvider struct {
+	scm.Provider
+	err error
+}
+
+func (p *failingProvider) ReadProjectInfo(ctx context.Context, owner, repo, branch string) (*types.ProjectInfo, error) {
+	return nil, p.err
+}
+
+func TestTolerate(t *testing.T) {
+	root := t.TempDir()
+	writeRepo(t, root, "acme", "shop", map[string]string{
+		"project-info.yaml":                   "deployment: {namespace: shop}\n",
+		"deployment/k8s/prod/api/values.yaml": "replicas: 2\n",
+	})
+	client, err := local.NewClient(root, "https://git.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unavailable := errors.New("503 service unavailable")
+
+	tests := []struct {
+		name    string
+		err     error
+		strict  bool
+		wantErr bool
+	}{
+		{"strict, transient error", unavailable, true, true},
+		{"strict, not found", fmt.Errorf("project-info.yaml: %w", scm.ErrNotFound), true, false},
+		{"lenient, transient error", unavailable, false, false},
+		{"lenient, not found", fmt.Errorf("project-info.yaml: %w", scm.ErrNotFound), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGenerator(&types.Config{
+				DefaultProvider: "local",
+				DefaultBranch:   "main",
+				StrictMode:      tt.strict,
+				DefaultClusters: []types.ClusterConfig{{Name: "c1", DestinationName: "c1"}},
+			}, &failingProvider{Provider: client, err: tt.err})
+
+			parameters, err := g.GenerateParameters(context.Background(), types.PluginParameters{
+				Organization: "acme",
+				Repository:   "shop",
+				URL:          "https://git.example.com/acme/shop.git",
+				Envs:         []string{"prod"},
+			})
+			if tt.wantErr {
+				if !errors.Is(err, unavailable) {
+					t.Errorf("err = %v, want the provider error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateParameters: %v", err)
+			}
+			// The repo is generated with defaults instead of project-info.yaml
+			if len(parameters) != 1 || parameters[0].Namespace != "shop" {
+				t.Errorf("got %+v, want one application in the default namespace shop", parameters)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/metrics"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+var (
+	guardTrips = metrics.NewCounter("scm_plugin_deletion_guard_trips_total",
+		"Number of generations held back by the mass-deletion guard")
+	guardWithheld = metrics.NewCounter("scm_plugin_deletion_guard_withheld_applications_total",
+		"Number of applications that would have been removed when the guard tripped")
+	guardAccepted = metrics.NewCounter("scm_plugin_deletion_guard_accepted_total",
+		"Number of withheld results accepted by override or after being generated unchanged")
+)
+
+// guardRetention is how long the guard keeps the baseline of a request that
+// is no longer made, e.g. of a changed or deleted ApplicationSet
+const guardRetention = 24 * time.Hour
+
+// deletionGuard remembers the last successful result per request and holds
+// back new results that would remove too many Applications at once
+type deletionGuard struct {
+	maxPercent float64
+	maxCount   int
+	// minBaseline is the number of Applications below which the percent limit
+	// does not apply, so removing one of a few Applications is allowed
+	minBaseline int
+	// acceptAfter accepts a withheld result once the same removal has been
+	// generated for this long (0 never accepts)
+	acceptAfter time.Duration
+	// retention drops baselines not checked for this long
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	last    map[string]*baseline
+	pending map[string]pendingRemoval
+}
+
+// baseline is the last accepted result of a request
+type baseline struct {
+	parameters []types.Parameter
+	checked    time.Time
+}
+
+// pendingRemoval is a withheld removal and since when it has been generated unchanged
+type pendingRemoval struct {
+	removed string
+	since   time.Time
+}
+
+// newDeletionGuard creates a guard; a zero limit disables that check
+func newDeletionGuard(maxPercent float64, maxCount, minBaseline int, acceptAfter time.Duration) *deletionGuard {
+	return &deletionGuard{
+		maxPercent:  maxPercent,
+		maxCount:    maxCount,
+		minBaseline: minBaseline,
+		acceptAfter: acceptAfter,
+		retention:   guardRetention,
+		now:         time.Now,
+		last:        make(map[string]*baseline),
+		pending:     make(map[string]pendingRemoval),
+	}
+}
+
+// enabled reports whether any limit is configured
+func (d *deletionGuard) enabled() bool {
+	return d.maxPercent > 0 || d.maxCount > 0
+}
+
+// check compares parameters with the last result for the same fingerprint.
+// It returns the parameters to serve: the new ones, or the previous ones when
+// the new result drops more Applications than allowed. allowDeletions
+// accepts the new result regardless of the limits.
+func (d *deletionGuard) check(fingerprint string, parameters []types.Parameter, allowDeletions bool) []types.Parameter {
+	if !d.enabled() {
+		return parameters
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire()
+	last, exists := d.last[fingerprint]
+	if !exists || len(last.parameters) == 0 {
+		d.accept(fingerprint, parameters)
+		return parameters
+	}
+	last.checked = d.now()
+	previous := last.parameters
+
+	removed := removedApplications(previous, parameters)
+	percent := float64(len(removed)) / float64(len(previous)) * 100
+
+	tripped := (d.maxCount > 0 && len(removed) > d.maxCount) ||
+		(d.maxPercent > 0 && len(previous) >= d.minBaseline && percent > d.maxPercent)
+	if !tripped {
+		d.accept(fingerprint, parameters)
+		return parameters
+	}
+
+	if allowDeletions {
+		guardAccepted.Inc()
+		log.Printf("Deletion guard: removal of %d of %d applications allowed by request: %v", len(removed), len(previous), removed)
+		d.accept(fingerprint, parameters)
+		return parameters
+	}
+
+	// A removal generated unchanged for acceptAfter is intended, not a transient failure
+	key := strings.Join(removed, ",")
+	pending, seen := d.pending[fingerprint]
+	if !seen || pending.removed != key {
+		pending = pendingRemoval{removed: key, since: d.now()}
+		d.pending[fingerprint] = pending
+	}
+	if d.acceptAfter > 0 && d.now().Sub(pending.since) >= d.acceptAfter {
+		guardAccepted.Inc()
+		log.Printf("Deletion guard: accepting removal of %d of %d applications generated unchanged since %s: %v",
+			len(removed), len(previous), pending.since.Format(time.RFC3339), removed)
+		d.accept(fingerprint, parameters)
+		return parameters
+	}
+
+	guardTrips.Inc()
+	guardWithheld.Add(len(removed))
+	log.Printf("Deletion guard tripped: new result would remove %d of %d applications (%.1f%%, limits: count=%d percent=%.1f); serving previous result. Would remove: %v",
+		len(removed), len(previous), percent, d.maxCount, d.maxPercent, removed)
+
+	return previous
+}
+
+// accept makes parameters the baseline of fingerprint
+func (d *deletionGuard) accept(fingerprint string, parameters []types.Parameter) {
+	d.last[fingerprint] = &baseline{parameters: parameters, checked: d.now()}
+	delete(d.pending, fingerprint)
+}
+
+// expire drops the baselines of requests not made within the retention
+func (d *deletionGuard) expire() {
+	now := d.now()
+	for fingerprint, last := range d.last {
+		if now.Sub(last.checked) > d.retention {
+			delete(d.last, fingerprint)
+			delete(d.pending, fingerprint)
+		}
+	}
+}
+
+// removedApplications returns the keys present in previous but not in current
+func removedApplications(previous, current []types.Parameter) []string {
+	currentKeys := make(map[string]bool, len(current))
+	for _, param := range current {
+		currentKeys[parameterKey(param)] = true
+	}
+
+	var removed []string
+	for _, param := range previous {
+		key := parameterKey(param)
+		if !currentKeys[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// parameterKey identifies the Application generated from a parameter set
+func parameterKey(param types.Parameter) string {
+	if param.ApplicationName != "" {
+		return param.ApplicationName
+	}
+	// Path mode does not generate application names
+	return fmt.Sprintf("%s/%s/%s/%s/%s", param.Organization, param.Repository, param.Env, param.ChartName, param.Cluster)
+}
+
+// requestFingerprint identifies requests coming from the same ApplicationSet generator.
+// AllowDeletions is left out so the override applies to the existing baseline.
+func requestFingerprint(params types.PluginParameters) string {
+	params.AllowDeletions = false
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
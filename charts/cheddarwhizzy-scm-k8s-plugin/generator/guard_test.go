@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// applications returns parameters for the Applications app-0 to app-<n-1>
+func applications(n int) []types.Parameter {
+	parameters := make([]types.Parameter, n)
+	for i := range parameters {
+		parameters[i] = types.Parameter{ApplicationName: fmt.Sprintf("app-%d", i)}
+	}
+	return parameters
+}
+
+func TestDeletionGuardCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxPercent     float64
+		maxCount       int
+		minBaseline    int
+		previous, next int
+		allowDeletions bool
+		wantPrevious   bool
+	}{
+		{name: "disabled", previous: 10, next: 0},
+		{name: "under count", maxCount: 2, previous: 10, next: 8},
+		{name: "over count", maxCount: 2, previous: 10, next: 7, wantPrevious: true},
+		{name: "under percent", maxPercent: 20, minBaseline: 10, previous: 10, next: 8},
+		{name: "over percent", maxPercent: 20, minBaseline: 10, previous: 10, next: 7, wantPrevious: true},
+		{name: "percent below min baseline", maxPercent: 20, minBaseline: 10, previous: 5, next: 1},
+		{name: "count below min baseline", maxCount: 2, minBaseline: 10, previous: 5, next: 1, wantPrevious: true},
+		{name: "additions only", maxCount: 1, previous: 3, next: 10},
+		{name: "allow deletions", maxCount: 2, previous: 10, next: 0, allowDeletions: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := newDeletionGuard(tt.maxPercent, tt.maxCount, tt.minBaseline, 0)
+			guard.check("request", applications(tt.previous), false)
+
+			want := applications(tt.next)
+			if tt.wantPrevious {
+				want = applications(tt.previous)
+			}
+			served := guard.check("request", applications(tt.next), tt.allowDeletions)
+			if len(served) != len(want) {
+				t.Errorf("served %d applications, want %d", len(served), len(want))
+			}
+		})
+	}
+}
+
+func TestDeletionGuardKeepsBaselineWhenTripped(t *testing.T) {
+	guard := newDeletionGuard(0, 2, 0, 0)
+	guard.check("request", applications(10), false)
+
+	// Every withheld result is compared to the last accepted one, not to itself
+	for i := 0; i < 3; i++ {
+		if served := guard.check("request", applications(5), false); len(served) != 10 {
+			t.Fatalf("check %d: served %d applications, want the previous 10", i, len(served))
+		}
+	}
+	// Other requests have their own baseline
+	if served := guard.check("other", applications(1), false); len(served) != 1 {
+		t.Errorf("other request: served %d applications, want 1", len(served))
+	}
+	// The override accepts the removal and makes it the new baseline
+	guard.check("request", applications(5), true)
+	if served := guard.check("request", applications(4), false); len(served) != 4 {
+		t.Errorf("after override: served %d applications, want 4", len(served))
+	}
+}
+
+func TestDeletionGuardAcceptAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard := newDeletionGuard(0, 2, 0, time.Hour)
+	guard.now = func() time.Time { return now }
+	guard.check("request", applications(10), false)
+
+	if served := guard.check("request", applications(5), false); len(served) != 10 {
+		t.Fatalf("served %d applications, want the previous 10", len(served))
+	}
+	now = now.Add(40 * time.Minute)
+	// A different removal restarts the wait
+	if served := guard.check("request", applications(6), false); len(served) != 10 {
+		t.Fatalf("changed removal: served %d applications, want the previous 10", len(served))
+	}
+	now = now.Add(40 * time.Minute)
+	if served := guard.check("request", applications(6), false); len(served) != 10 {
+		t.Fatalf("after 40m: served %d applications, want the previous 10", len(served))
+	}
+	now = now.Add(20 * time.Minute)
+	if served := guard.check("request", applications(6), false); len(served) != 6 {
+		t.Fatalf("after 1h unchanged: served %d applications, want 6", len(served))
+	}
+	if served := guard.check("request", applications(6), false); len(served) != 6 {
+		t.Errorf("accepted removal is the new baseline: served %d applications, want 6", len(served))
+	}
+}
+
+func TestDeletionGuardRetention(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard := newDeletionGuard(0, 2, 0, 0)
+	guard.now = func() time.Time { return now }
+	guard.check("active", applications(10), false)
+	guard.check("deleted", applications(10), false)
+	guard.check("deleted", applications(5), false)
+
+	now = now.Add(guardRetention / 2)
+	guard.check("active", applications(10), false)
+	now = now.Add(guardRetention/2 + time.Minute)
+	guard.check("active", applications(10), false)
+
+	guard.mu.Lock()
+	_, active := guard.last["active"]
+	_, deleted := guard.last["deleted"]
+	_, pending := guard.pending["deleted"]
+	guard.mu.Unlock()
+	if !active || deleted || pending {
+		t.Errorf("baselines: active %v, deleted %v (pending %v); want only the active one kept", active, deleted, pending)
+	}
+}
+
+func TestRequestFingerprintIgnoresAllowDeletions(t *testing.T) {
+	params := types.PluginParameters{Orgs: []string{"acme"}}
+	allowed := params
+	allowed.AllowDeletions = true
+	if requestFingerprint(params) != requestFingerprint(allowed) {
+		t.Error("allowDeletions changes the fingerprint")
+	}
+	other := params
+	other.Orgs = []string{"other"}
+	if requestFingerprint(params) == requestFingerprint(other) {
+		t.Error("different orgs share a fingerprint")
+	}
+}
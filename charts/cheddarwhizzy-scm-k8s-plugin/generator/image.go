@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"context"
+	"log"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// readImages reads image.yaml and the image-<cluster>.yaml of clusters from a
+// chart directory, keyed by file name. The image parameters are informational,
+// so files that cannot be read or parsed are logged and left out, also in
+// strict mode; ArgoCD still reads them as value files.
+func (g *Generator) readImages(ctx context.Context, req *request, org, repo, dir string, files map[string]bool, clusters []string) map[string]*types.Image {
+	names := []string{"image.yaml"}
+	for _, cluster := range clusters {
+		names = append(names, "image-"+cluster+".yaml")
+	}
+
+	images := make(map[string]*types.Image)
+	for _, name := range names {
+		if !files[name] {
+			continue
+		}
+		data, err := req.scm.ReadFile(ctx, org, repo, req.branch, dir+"/"+name)
+		if err != nil {
+			log.Printf("Warning: failed to read %s/%s in %s/%s: %v", dir, name, org, repo, err)
+			continue
+		}
+		image, err := config.ParseImage(data)
+		if err != nil {
+			log.Printf("Warning: ignoring image of %s/%s in %s/%s: %v", dir, name, org, repo, err)
+			continue
+		}
+		images[name] = image
+	}
+	return images
+}
+
+// effectiveImage merges the image of image.yaml with the overrides of
+// image-<cluster>.yaml, mirroring the order of the value files
+func effectiveImage(images map[string]*types.Image, clusterName string) types.Image {
+	var effective types.Image
+	for _, name := range []string{"image.yaml", "image-" + clusterName + ".yaml"} {
+		image := images[name]
+		if image == nil {
+			continue
+		}
+		if image.Repository != "" {
+			effective.Repository = image.Repository
+		}
+		if image.Tag != "" {
+			effective.Tag = image.Tag
+		}
+	}
+	return effective
+}
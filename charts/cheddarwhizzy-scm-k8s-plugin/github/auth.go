@@ -0,0 +1,229 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// AppConfig configures authentication as a GitHub App
+type AppConfig struct {
+	AppID int64
+	// PrivateKey is the PEM encoded private key of the app
+	PrivateKey []byte
+	// InstallationID pins a single installation; when 0 the installation is
+	// looked up per org (or user) so several orgs can be walked
+	InstallationID int64
+}
+
+// appAuth mints installation tokens and keeps one API client per installation
+type appAuth struct {
+	appID          int64
+	key            *rsa.PrivateKey
+	installationID int64
+	appClient      *github.Client // authenticated with the app JWT
+
+	mu      sync.Mutex
+	clients map[string]*installationClient // per lowercased owner
+}
+
+// installationClient is the API client of one installation. done is closed
+// once client or err is set, so concurrent callers share a single lookup.
+type installationClient struct {
+	done   chan struct{}
+	client *github.Client
+	err    error
+}
+
+// NewAppClient creates a GitHub client authenticating as a GitHub App.
+// Installation tokens are refreshed five minutes before they expire.
+func NewAppClient(app AppConfig, opts ...Option) (*Client, error) {
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+
+	c, err := newClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// App endpoints are never cached: installation tokens must be fresh
+	jwtSource := oauth2.ReuseTokenSourceWithExpiry(nil, &jwtTokenSource{appID: app.AppID, key: key}, time.Minute)
+	appClient, err := c.newAPIClient(jwtSource, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.app = &appAuth{
+		appID:          app.AppID,
+		key:            key,
+		installationID: app.InstallationID,
+		appClient:      appClient,
+		clients:        make(map[string]*installationClient),
+	}
+	return c, nil
+}
+
+// clientFor returns the API client authorized for owner's repositories
+func (c *Client) clientFor(ctx context.Context, owner string) (*github.Client, error) {
+	if c.app == nil {
+		return c.client, nil
+	}
+
+	key := strings.ToLower(owner)
+	if c.app.installationID != 0 {
+		// A pinned installation serves every owner
+		key = ""
+	}
+
+	// The lookup is a network call; the lock only guards the map so owners
+	// are looked up concurrently, and each owner once
+	c.app.mu.Lock()
+	entry, exists := c.app.clients[key]
+	if !exists {
+		entry = &installationClient{done: make(chan struct{})}
+		c.app.clients[key] = entry
+	}
+	c.app.mu.Unlock()
+
+	if !exists {
+		entry.client, entry.err = c.newInstallationClient(ctx, owner)
+		if entry.err != nil {
+			// Failed lookups are retried by the next call
+			c.app.mu.Lock()
+			delete(c.app.clients, key)
+			c.app.mu.Unlock()
+		}
+		close(entry.done)
+	}
+
+	select {
+	case <-entry.done:
+		return entry.client, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newInstallationClient creates the API client of the installation serving owner
+func (c *Client) newInstallationClient(ctx context.Context, owner string) (*github.Client, error) {
+	installationID := c.app.installationID
+	if installationID == 0 {
+		id, err := c.app.findInstallation(ctx, owner)
+		if err != nil {
+			return nil, err
+		}
+		installationID = id
+	}
+
+	log.Printf("Using GitHub App installation %d for %s", installationID, owner)
+	tokenSource := oauth2.ReuseTokenSourceWithExpiry(nil, &installationTokenSource{
+		appClient:      c.app.appClient,
+		installationID: installationID,
+	}, 5*time.Minute)
+	return c.newAPIClient(tokenSource, true)
+}
+
+// findInstallation looks up the app installation for an org, then for a user
+func (a *appAuth) findInstallation(ctx context.Context, owner string) (int64, error) {
+	installation, _, err := a.appClient.Apps.FindOrganizationInstallation(ctx, owner)
+	if IsNotFound(err) {
+		installation, _, err = a.appClient.Apps.FindUserInstallation(ctx, owner)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find GitHub App installation for %s: %w", owner, wrapNotFound(err))
+	}
+	return installation.GetID(), nil
+}
+
+// installationTokenSource mints installation access tokens (valid for one hour)
+type installationTokenSource struct {
+	appClient      *github.Client
+	installationID int64
+}
+
+// Token implements oauth2.TokenSource
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, _, err := s.appClient.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for installation %d: %w", s.installationID, err)
+	}
+	log.Printf("Refreshed GitHub App installation token for installation %d (expires %s)", s.installationID, token.GetExpiresAt().Format(time.RFC3339))
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// jwtTokenSource signs the RS256 JWTs that authenticate as the app itself
+type jwtTokenSource struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+// Token implements oauth2.TokenSource
+func (s *jwtTokenSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	// Backdate to tolerate clock drift; GitHub accepts at most 10 minutes of validity
+	issuedAt := now.Add(-time.Minute)
+	expiresAt := now.Add(9 * time.Minute)
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
+		"iss": s.appID,
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: unsigned + "." + base64.RawURLEncoding.EncodeToString(signature),
+		TokenType:   "Bearer",
+		Expiry:      expiresAt,
+	}, nil
+}
+
+// parsePrivateKey parses a PKCS#1 or PKCS#8 PEM encoded RSA key
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
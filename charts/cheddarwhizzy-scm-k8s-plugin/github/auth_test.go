@@ -0,0 +1,267 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := newTestKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := x509.MarshalPKCS8PrivateKey(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"not pem", []byte("not a key"), true},
+		{"garbage block", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}), true},
+		{"not rsa", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecKey}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parsePrivateKey(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.Equal(key) {
+				t.Error("parsed key differs from the encoded key")
+			}
+		})
+	}
+}
+
+func TestJWTTokenSource(t *testing.T) {
+	key := newTestKey(t)
+	token, err := (&jwtTokenSource{appID: 42, key: key}).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.TokenType != "Bearer" {
+		t.Errorf("token type = %q, want Bearer", token.TokenType)
+	}
+
+	claims, err := verifyJWT(token.AccessToken, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != 42 {
+		t.Errorf("iss = %d, want 42", claims["iss"])
+	}
+	now := time.Now().Unix()
+	if claims["iat"] > now || claims["iat"] < now-120 {
+		t.Errorf("iat = %d, want backdated by about a minute from %d", claims["iat"], now)
+	}
+	if validity := claims["exp"] - claims["iat"]; validity > 600 {
+		t.Errorf("JWT valid for %ds, GitHub accepts at most 600s", validity)
+	}
+	if token.Expiry.Unix() != claims["exp"] {
+		t.Errorf("token expiry %d does not match exp claim %d", token.Expiry.Unix(), claims["exp"])
+	}
+}
+
+func TestAppClientInstallationTokens(t *testing.T) {
+	key := newTestKey(t)
+	installations := map[string]int64{"/orgs/acme/installation": 1, "/users/octo/installation": 2}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	var repoAuth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+		mu.Lock()
+		calls[path]++
+		mu.Unlock()
+
+		if strings.HasPrefix(path, "/repos/") {
+			mu.Lock()
+			repoAuth = append(repoAuth, r.Header.Get("Authorization"))
+			mu.Unlock()
+			fmt.Fprint(w, `{"name":"app"}`)
+			return
+		}
+
+		// App endpoints are authenticated with the app JWT
+		claims, err := verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		if err != nil || claims["iss"] != 42 {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		if id, ok := installations[path]; ok {
+			fmt.Fprintf(w, `{"id":%d}`, id)
+			return
+		}
+		var id int64
+		if _, err := fmt.Sscanf(path, "/app/installations/%d/access_tokens", &id); err == nil && r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"token-%d","expires_at":%q}`, id, time.Now().Add(time.Hour).Format(time.RFC3339))
+			return
+		}
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	c, err := NewAppClient(AppConfig{AppID: 42, PrivateKey: pemKey},
+		WithEnterpriseURLs(server.URL+"/api/v3/", ""), WithResponseCache(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, owner := range []string{"acme", "octo", "ACME", "octo"} {
+		client, err := c.clientFor(ctx, owner)
+		if err != nil {
+			t.Fatalf("%s: %v", owner, err)
+		}
+		if _, _, err := client.Repositories.Get(ctx, owner, "app"); err != nil {
+			t.Fatalf("%s: %v", owner, err)
+		}
+	}
+
+	want := []string{"token token-1", "token token-2", "token token-1", "token token-2"}
+	if strings.Join(repoAuth, ",") != strings.Join(want, ",") {
+		t.Errorf("repo requests authorized with %v, want %v", repoAuth, want)
+	}
+	// Each owner is looked up once and its token reused until it nears expiry
+	for path, want := range map[string]int{
+		"/orgs/acme/installation":            1,
+		"/orgs/octo/installation":            1,
+		"/users/octo/installation":           1,
+		"/app/installations/1/access_tokens": 1,
+		"/app/installations/2/access_tokens": 1,
+	} {
+		if calls[path] != want {
+			t.Errorf("%s called %d times, want %d", path, calls[path], want)
+		}
+	}
+
+	if _, err := c.clientFor(ctx, "nobody"); !IsNotFound(err) {
+		t.Errorf("owner without installation: got %v, want a not found error", err)
+	}
+}
+
+func TestAppClientPinnedInstallation(t *testing.T) {
+	key := newTestKey(t)
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/api/v3"))
+		mu.Unlock()
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"pinned","expires_at":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+			return
+		}
+		fmt.Fprint(w, `{"name":"app"}`)
+	}))
+	defer server.Close()
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	c, err := NewAppClient(AppConfig{AppID: 42, PrivateKey: pemKey, InstallationID: 7},
+		WithEnterpriseURLs(server.URL+"/api/v3/", ""), WithResponseCache(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, owner := range []string{"acme", "octo"} {
+		client, err := c.clientFor(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := client.Repositories.Get(ctx, owner, "app"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No installation lookup, and one token serves every owner
+	want := "POST /app/installations/7/access_tokens,GET /repos/acme/app,GET /repos/octo/app"
+	if got := strings.Join(paths, ","); got != want {
+		t.Errorf("requests = %s, want %s", got, want)
+	}
+}
+
+// verifyJWT checks an RS256 JWT signature and returns its numeric claims
+func verifyJWT(token string, key *rsa.PublicKey) (map[string]int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT %q", token)
+	}
+
+	var header map[string]string
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return nil, fmt.Errorf("unexpected JWT header %v", header)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]int64
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
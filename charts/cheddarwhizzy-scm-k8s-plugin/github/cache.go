@@ -0,0 +1,231 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/metrics"
+)
+
+var (
+	cacheHits = metrics.NewCounter("scm_plugin_github_cache_hits_total",
+		"GitHub GET requests served from the response cache without a request")
+	cacheMisses = metrics.NewCounter("scm_plugin_github_cache_misses_total",
+		"GitHub GET requests that fetched a new response")
+	cacheRevalidations = metrics.NewCounter("scm_plugin_github_cache_revalidations_total",
+		"GitHub GET requests answered with 304 Not Modified (not counted against the rate limit)")
+	cacheEvictions = metrics.NewCounter("scm_plugin_github_cache_evictions_total",
+		"Responses evicted from the GitHub response cache to respect its maximum size")
+)
+
+// cacheKey identifies cached content by repository, ref and path.
+// Requests that are not about repository content use the URL as Path.
+type cacheKey struct {
+	Owner string
+	Repo  string
+	Ref   string
+	Path  string
+}
+
+// cacheEntry is a stored 200 response
+type cacheEntry struct {
+	key      cacheKey
+	etag     string
+	raw      []byte // response dumped with httputil.DumpResponse
+	storedAt time.Time
+}
+
+// responseCache is an LRU of GitHub responses shared by all transports of a
+// client, bounded by the number of responses and their total size
+type responseCache struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int // 0 leaves the size unbounded
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[cacheKey]*list.Element
+	size    int // total length of the stored responses
+}
+
+func newResponseCache(ttl time.Duration, maxEntries, maxBytes int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// get returns the entry for key and marks it as recently used
+func (rc *responseCache) get(key cacheKey) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, exists := rc.entries[key]
+	if !exists {
+		return nil
+	}
+	rc.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry)
+}
+
+// put stores an entry, evicting the least recently used ones beyond
+// maxEntries or maxBytes. A response larger than maxBytes is not stored.
+func (rc *responseCache) put(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, exists := rc.entries[entry.key]; exists {
+		rc.remove(elem)
+	}
+	if rc.maxBytes > 0 && len(entry.raw) > rc.maxBytes {
+		return
+	}
+	rc.entries[entry.key] = rc.order.PushFront(entry)
+	rc.size += len(entry.raw)
+
+	for rc.order.Len() > rc.maxEntries || (rc.maxBytes > 0 && rc.size > rc.maxBytes) {
+		rc.remove(rc.order.Back())
+		cacheEvictions.Inc()
+	}
+}
+
+// remove drops an entry; the caller holds the lock
+func (rc *responseCache) remove(elem *list.Element) {
+	entry := rc.order.Remove(elem).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	rc.size -= len(entry.raw)
+}
+
+// touch resets the age of an entry after a successful revalidation
+func (rc *responseCache) touch(key cacheKey) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// Entries are replaced rather than mutated so readers never race
+	if elem, exists := rc.entries[key]; exists {
+		updated := *elem.Value.(*cacheEntry)
+		updated.storedAt = time.Now()
+		elem.Value = &updated
+	}
+}
+
+// cacheTransport serves GET requests from a responseCache. Fresh entries are
+// returned directly; stale ones are revalidated with If-None-Match.
+type cacheTransport struct {
+	cache *responseCache
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	key := keyForURL(req.URL)
+	entry := t.cache.get(key)
+	if entry != nil && time.Since(entry.storedAt) < t.cache.ttl {
+		cacheHits.Inc()
+		return entry.response(req)
+	}
+
+	if entry != nil && entry.etag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		cacheRevalidations.Inc()
+		t.cache.touch(key)
+		return entry.response(req)
+	}
+
+	cacheMisses.Inc()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	raw, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	t.cache.put(&cacheEntry{
+		key:      key,
+		etag:     resp.Header.Get("ETag"),
+		raw:      raw,
+		storedAt: time.Now(),
+	})
+	// DumpResponse leaves resp.Body readable
+	return resp, nil
+}
+
+// response rebuilds the stored response for req
+func (e *cacheEntry) response(req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(e.raw)), req)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the body is fully buffered and independent from the cache entry
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// keyForURL derives the cache key of a GitHub API request:
+// /repos/{owner}/{repo}/contents/{path}?ref={ref} and
+// /repos/{owner}/{repo}/git/trees/{ref} are keyed by repository content,
+// anything else by its full URL
+func keyForURL(u *url.URL) cacheKey {
+	// Enterprise API URLs are prefixed with /api/v3
+	p := u.Path
+	if idx := strings.Index(p, "/repos/"); idx >= 0 {
+		p = p[idx+len("/repos/"):]
+		parts := strings.SplitN(p, "/", 4)
+		if len(parts) == 4 {
+			owner, repo, rest := parts[0], parts[1], parts[2]+"/"+parts[3]
+			switch {
+			case strings.HasPrefix(rest, "contents/"):
+				return cacheKey{Owner: owner, Repo: repo, Ref: u.Query().Get("ref"), Path: strings.TrimPrefix(rest, "contents/")}
+			case strings.HasPrefix(rest, "git/trees/") && u.Query().Get("recursive") != "":
+				return cacheKey{Owner: owner, Repo: repo, Ref: strings.TrimPrefix(rest, "git/trees/")}
+			}
+		}
+	}
+	return cacheKey{Path: u.String()}
+}
+
+// invalidate drops the responses cached for a repository at ref
+func (rc *responseCache) invalidate(owner, repo, ref string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	removed := 0
+	for key, elem := range rc.entries {
+		if strings.EqualFold(key.Owner, owner) && strings.EqualFold(key.Repo, repo) && key.Ref == ref {
+			rc.remove(elem)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,106 @@
+package github
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheMaxBytes(t *testing.T) {
+	rc := newResponseCache(time.Minute, 100, 250)
+	put := func(path string, size int) {
+		rc.put(&cacheEntry{key: cacheKey{Path: path}, raw: []byte(strings.Repeat("x", size))})
+	}
+
+	put("a", 100)
+	put("b", 100)
+	rc.get(cacheKey{Path: "a"})
+	put("c", 100) // evicts b, the least recently used
+	if rc.get(cacheKey{Path: "b"}) != nil || rc.get(cacheKey{Path: "a"}) == nil || rc.get(cacheKey{Path: "c"}) == nil {
+		t.Errorf("expected only b to be evicted")
+	}
+	if rc.size != 200 {
+		t.Errorf("size = %d, want 200", rc.size)
+	}
+
+	put("a", 50) // replacing an entry releases its old size
+	if rc.size != 150 {
+		t.Errorf("size after replace = %d, want 150", rc.size)
+	}
+
+	put("huge", 300)
+	if rc.get(cacheKey{Path: "huge"}) != nil || rc.size != 150 {
+		t.Errorf("a response larger than maxBytes must not be stored")
+	}
+}
+
+func TestCacheTransportRevalidation(t *testing.T) {
+	var mu sync.Mutex
+	var conditional []string // If-None-Match of each request reaching the server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "replicas: 1\n")
+	}))
+	defer server.Close()
+
+	cache := newResponseCache(time.Hour, 100, 0)
+	client := &http.Client{Transport: &cacheTransport{cache: cache, next: http.DefaultTransport}}
+	url := server.URL + "/repos/acme/shop/contents/values.yaml?ref=main"
+	key := cacheKey{Owner: "acme", Repo: "shop", Ref: "main", Path: "values.yaml"}
+	get := func(step string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "replicas: 1\n" {
+			t.Fatalf("%s: got %d %q, want the cached body", step, resp.StatusCode, body)
+		}
+	}
+	requests := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), conditional...)
+	}
+
+	get("first request")
+	get("fresh entry")
+	if got := requests(); len(got) != 1 || got[0] != "" {
+		t.Fatalf("server requests = %q, want one unconditional request", got)
+	}
+
+	// A stale entry is revalidated and the 304 answered from the cache
+	cache.get(key).storedAt = time.Now().Add(-2 * time.Hour)
+	get("stale entry")
+	if got := requests(); len(got) != 2 || got[1] != `"v1"` {
+		t.Fatalf("server requests = %q, want a revalidation with If-None-Match", got)
+	}
+	if age := time.Since(cache.get(key).storedAt); age > time.Minute {
+		t.Errorf("entry age after revalidation = %s, want it refreshed", age)
+	}
+	get("revalidated entry")
+	if got := requests(); len(got) != 2 {
+		t.Fatalf("server requests = %q, want the refreshed entry served from the cache", got)
+	}
+
+	if removed := cache.invalidate("Acme", "shop", "main"); removed != 1 {
+		t.Errorf("invalidate removed %d entries, want 1", removed)
+	}
+	get("after invalidation")
+	if got := requests(); len(got) != 3 || got[2] != "" {
+		t.Errorf("server requests = %q, want an unconditional request after invalidation", got)
+	}
+}
@@ -2,11 +2,18 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/pool"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/utils"
 	"github.com/google/go-github/v57/github"
 	"golang.org/x/oauth2"
 	"gopkg.in/yaml.v3"
@@ -14,28 +21,204 @@ import (
 
 // Client wraps GitHub API client
 type Client struct {
-	client *github.Client
+	client    *github.Client // token authentication
+	app       *appAuth       // GitHub App authentication
+	trees     *treeCache
+	responses *responseCache
+	// requests are paced once fewer calls than this remain in the rate limit
+	rateLimitReserve int
+
+	// GitHub Enterprise Server API endpoints (empty for github.com)
+	baseURL   string
+	uploadURL string
+	// host used when building repo URLs
+	host string
 }
 
-// NewClient creates a new GitHub client
-func NewClient(token string) *Client {
-	ctx := context.Background()
+// Option configures a Client
+type Option func(*Client)
+
+// WithTreeTTL sets how long a fetched repository tree is reused
+func WithTreeTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.trees.ttl = ttl
+	}
+}
+
+// WithResponseCache sets how long GitHub responses are served without a
+// request, how many are kept and their maximum total size in bytes (0 for no
+// size bound). Older responses are revalidated with If-None-Match; a
+// maxEntries of 0 disables the cache.
+func WithResponseCache(ttl time.Duration, maxEntries, maxBytes int) Option {
+	return func(c *Client) {
+		c.responses = nil
+		if maxEntries > 0 {
+			c.responses = newResponseCache(ttl, maxEntries, maxBytes)
+		}
+	}
+}
+
+// WithRateLimitReserve sets the remaining rate-limit budget below which
+// requests are spread out until the limit resets (0 only waits when exhausted)
+func WithRateLimitReserve(reserve int) Option {
+	return func(c *Client) {
+		c.rateLimitReserve = reserve
+	}
+}
+
+// WithEnterpriseURLs targets a GitHub Enterprise Server instance, e.g.
+// https://github.example.com/api/v3/ and https://github.example.com/api/uploads/.
+// An empty uploadURL defaults to baseURL.
+func WithEnterpriseURLs(baseURL, uploadURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+		c.uploadURL = uploadURL
+		if c.uploadURL == "" {
+			c.uploadURL = baseURL
+		}
+	}
+}
+
+// WithHost sets the host used in generated repo URLs (git@<host>:<owner>/<repo>.git).
+// It defaults to github.com, or to the Enterprise Server host.
+func WithHost(host string) Option {
+	return func(c *Client) {
+		c.host = host
+	}
+}
+
+// NewClient creates a new GitHub client authenticating with a personal access token
+func NewClient(token string, opts ...Option) (*Client, error) {
+	c, err := newClient(opts...)
+	if err != nil {
+		return nil, err
+	}
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
-	return &Client{
-		client: github.NewClient(tc),
+	c.client, err = c.newAPIClient(ts, true)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient creates a client without authentication
+func newClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		trees:            newTreeCache(30 * time.Second),
+		responses:        newResponseCache(time.Minute, 10000, 128<<20),
+		rateLimitReserve: 200,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.host == "" {
+		c.host = "github.com"
+		if c.baseURL != "" {
+			parsed, err := url.Parse(c.baseURL)
+			if err != nil || parsed.Host == "" {
+				return nil, fmt.Errorf("invalid GitHub Enterprise URL %q", c.baseURL)
+			}
+			c.host = parsed.Hostname()
+		}
+	}
+	return c, nil
+}
+
+// newAPIClient creates a go-github client using ts, optionally sharing the response cache
+func (c *Client) newAPIClient(ts oauth2.TokenSource, cached bool) (*github.Client, error) {
+	tc := oauth2.NewClient(context.Background(), ts)
+	// Each token has its own rate limit; cache hits never reach the pacing
+	tc.Transport = newRateLimitTransport(c.rateLimitReserve, tc.Transport)
+	if cached && c.responses != nil {
+		tc.Transport = &cacheTransport{cache: c.responses, next: tc.Transport}
+	}
+	client := github.NewClient(tc)
+	if c.baseURL == "" {
+		return client, nil
+	}
+	client, err := client.WithEnterpriseURLs(c.baseURL, c.uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URLs: %w", err)
+	}
+	return client, nil
+}
+
+// Client implements scm.Provider
+var _ scm.Provider = (*Client)(nil)
+
+// IsNotFound reports whether err was caused by a 404 from the GitHub API
+func IsNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return errResp.Response.StatusCode == http.StatusNotFound
+	}
+	return scm.IsNotFound(err)
+}
+
+// wrapNotFound marks 404 responses with scm.ErrNotFound
+func wrapNotFound(err error) error {
+	if IsNotFound(err) {
+		return fmt.Errorf("%w: %w", scm.ErrNotFound, err)
+	}
+	return err
+}
+
+// Client drops cached data on push webhooks
+var _ scm.Invalidator = (*Client)(nil)
+
+// Invalidate drops cached trees and responses of a repository at ref
+func (c *Client) Invalidate(owner, repo, ref string) {
+	c.trees.invalidate(owner, repo, ref)
+	if c.responses != nil {
+		removed := c.responses.invalidate(owner, repo, ref)
+		log.Printf("Invalidated %d cached responses for %s/%s@%s", removed, owner, repo, ref)
+	}
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return "github"
+}
+
+// RepoURL builds the SSH clone URL for a repository
+func (c *Client) RepoURL(owner, repo string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", c.host, owner, repo)
+}
+
+// ParseRepoURL extracts owner and repo name from a git URL of this client's host
+func (c *Client) ParseRepoURL(repoURL string) (string, string, error) {
+	host, owner, repo, err := utils.ParseRepoURLWithHost(repoURL)
+	if err != nil {
+		return "", "", err
 	}
+	if !strings.EqualFold(host, c.host) {
+		return "", "", fmt.Errorf("URL %s does not belong to GitHub host %s", repoURL, c.host)
+	}
+	// GitHub has no nested groups: a longer path is not a repository
+	if strings.Contains(owner, "/") {
+		return "", "", fmt.Errorf("invalid GitHub repository URL %s: expected <owner>/<repo>", repoURL)
+	}
+	return owner, repo, nil
 }
 
 // ReadProjectInfo reads project-info.yaml from a repository
 func (c *Client) ReadProjectInfo(ctx context.Context, owner, repo, branch string) (*types.ProjectInfo, error) {
-	fileContent, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, "project-info.yaml", &github.RepositoryContentGetOptions{
+	if err := c.checkExists(ctx, owner, repo, branch, "project-info.yaml"); err != nil {
+		return nil, fmt.Errorf("failed to get project-info.yaml: %w", err)
+	}
+
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	fileContent, _, _, err := gh.Repositories.GetContents(ctx, owner, repo, "project-info.yaml", &github.RepositoryContentGetOptions{
 		Ref: branch,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get project-info.yaml: %w", err)
+		return nil, fmt.Errorf("failed to get project-info.yaml: %w", wrapNotFound(err))
 	}
 
 	// Decode base64 content
@@ -52,14 +235,49 @@ func (c *Client) ReadProjectInfo(ctx context.Context, owner, repo, branch string
 	return &projectInfo, nil
 }
 
+// ReadFile returns the content of a file
+func (c *Client) ReadFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error) {
+	if err := c.checkExists(ctx, owner, repo, branch, path); err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	fileContent, _, _, err := gh.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{
+		Ref: branch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, wrapNotFound(err))
+	}
+	if fileContent == nil {
+		return nil, fmt.Errorf("%s is a directory: %w", path, scm.ErrNotFound)
+	}
+
+	content, err := fileContent.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file content: %w", err)
+	}
+	return []byte(content), nil
+}
+
 // ReadArgoCDConfig reads argocd-config.yaml from a chart directory
 func (c *Client) ReadArgoCDConfig(ctx context.Context, owner, repo, branch, chartPath string) (*types.ArgoCDConfig, error) {
 	configPath := fmt.Sprintf("%s/argocd-config.yaml", chartPath)
-	fileContent, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, configPath, &github.RepositoryContentGetOptions{
+	if err := c.checkExists(ctx, owner, repo, branch, configPath); err != nil {
+		return nil, fmt.Errorf("failed to get argocd-config.yaml: %w", err)
+	}
+
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	fileContent, _, _, err := gh.Repositories.GetContents(ctx, owner, repo, configPath, &github.RepositoryContentGetOptions{
 		Ref: branch,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get argocd-config.yaml: %w", err)
+		return nil, fmt.Errorf("failed to get argocd-config.yaml: %w", wrapNotFound(err))
 	}
 
 	// Decode base64 content
@@ -77,42 +295,101 @@ func (c *Client) ReadArgoCDConfig(ctx context.Context, owner, repo, branch, char
 }
 
 // DiscoverCharts discovers chart directories in a given path
+// If some chart directories cannot be checked, the charts that were confirmed
+// are returned together with an error describing the failed checks
 func (c *Client) DiscoverCharts(ctx context.Context, owner, repo, branch, envPath string) ([]string, error) {
+	tree, err := c.tree(ctx, owner, repo, branch)
+	if errors.Is(err, errTreeTruncated) {
+		return c.discoverChartsContents(ctx, owner, repo, branch, envPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !tree.IsDir(envPath) {
+		return nil, fmt.Errorf("failed to get contents of %s: %w", envPath, scm.ErrNotFound)
+	}
+
+	var charts []string
+	for _, chartName := range tree.ListDirs(envPath) {
+		// Check if it's a valid chart (has values.yaml or a kustomization - indicates env-specific override exists)
+		if !strings.HasPrefix(chartName, ".") && scm.IsChartDir(tree.ListFiles(fmt.Sprintf("%s/%s", envPath, chartName))) {
+			charts = append(charts, chartName)
+		}
+	}
+
+	return charts, nil
+}
+
+// discoverChartsContents discovers chart directories using the Contents API
+func (c *Client) discoverChartsContents(ctx context.Context, owner, repo, branch, envPath string) ([]string, error) {
 	// List contents of the env path
-	_, dirContents, _, err := c.client.Repositories.GetContents(ctx, owner, repo, envPath, &github.RepositoryContentGetOptions{
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	_, dirContents, _, err := gh.Repositories.GetContents(ctx, owner, repo, envPath, &github.RepositoryContentGetOptions{
 		Ref: branch,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get contents of %s: %w", envPath, err)
+		return nil, fmt.Errorf("failed to get contents of %s: %w", envPath, wrapNotFound(err))
 	}
 
 	var charts []string
+	var errs []error
 	for _, content := range dirContents {
 		if content.Type != nil && *content.Type == "dir" && content.Name != nil {
 			chartName := *content.Name
 			if !strings.HasPrefix(chartName, ".") {
-				// Check if it's a valid chart (has values.yaml - indicates env-specific override exists)
+				// Check if it's a valid chart (has values.yaml or a kustomization - indicates env-specific override exists)
 				chartPath := fmt.Sprintf("%s/%s", envPath, chartName)
-				if c.hasValuesYaml(ctx, owner, repo, branch, chartPath) {
+				files, err := c.listChartFilesContents(ctx, owner, repo, branch, chartPath)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if scm.IsChartDir(files) {
 					charts = append(charts, chartName)
 				}
 			}
 		}
 	}
 
-	return charts, nil
+	return charts, errors.Join(errs...)
 }
 
 // ListChartFiles lists all files in a chart directory and returns a map of filename -> exists
 func (c *Client) ListChartFiles(ctx context.Context, owner, repo, branch, chartDirPath string) (map[string]bool, error) {
+	tree, err := c.tree(ctx, owner, repo, branch)
+	if errors.Is(err, errTreeTruncated) {
+		return c.listChartFilesContents(ctx, owner, repo, branch, chartDirPath)
+	}
+	if err != nil {
+		if scm.IsNotFound(err) {
+			return make(map[string]bool), nil
+		}
+		return make(map[string]bool), err
+	}
+
+	return tree.ListFiles(chartDirPath), nil
+}
+
+// listChartFilesContents lists the files in a chart directory using the Contents API
+func (c *Client) listChartFilesContents(ctx context.Context, owner, repo, branch, chartDirPath string) (map[string]bool, error) {
 	fileMap := make(map[string]bool)
 
-	_, directoryContents, _, err := c.client.Repositories.GetContents(ctx, owner, repo, chartDirPath, &github.RepositoryContentGetOptions{
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return make(map[string]bool), err
+	}
+	_, directoryContents, _, err := gh.Repositories.GetContents(ctx, owner, repo, chartDirPath, &github.RepositoryContentGetOptions{
 		Ref: branch,
 	})
 	if err != nil {
 		// If the directory doesn't exist, return empty map
-		return fileMap, nil
+		if IsNotFound(err) {
+			return fileMap, nil
+		}
+		return fileMap, fmt.Errorf("failed to list %s: %w", chartDirPath, err)
 	}
 
 	// Build map of filenames that exist
@@ -128,38 +405,70 @@ func (c *Client) ListChartFiles(ctx context.Context, owner, repo, branch, chartD
 }
 
 // HasPath checks if a path exists in a repository
-func (c *Client) HasPath(ctx context.Context, owner, repo, branch, path string) bool {
-	fileContent, directoryContents, _, err := c.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{
+// A missing path is reported as false with a nil error
+func (c *Client) HasPath(ctx context.Context, owner, repo, branch, path string) (bool, error) {
+	tree, err := c.tree(ctx, owner, repo, branch)
+	if errors.Is(err, errTreeTruncated) {
+		return c.hasPathContents(ctx, owner, repo, branch, path)
+	}
+	if err != nil {
+		if scm.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	exists := tree.HasPath(path)
+	log.Printf("    Path %s exists in %s/%s: %v", path, owner, repo, exists)
+	return exists, nil
+}
+
+// hasPathContents checks if a path exists using the Contents API
+func (c *Client) hasPathContents(ctx context.Context, owner, repo, branch, path string) (bool, error) {
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return false, err
+	}
+	fileContent, directoryContents, _, err := gh.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{
 		Ref: branch,
 	})
 	if err != nil {
 		log.Printf("    Path check failed for %s/%s/%s: %v", owner, repo, path, err)
-		return false
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check %s in %s/%s: %w", path, owner, repo, err)
 	}
 	// If directoryContents is not nil, it means the path exists as a directory
 	// If fileContent is not nil, it means the path exists as a file
 	exists := directoryContents != nil || fileContent != nil
 	log.Printf("    Path %s exists in %s/%s: %v (isDir: %v, isFile: %v)", path, owner, repo, exists, directoryContents != nil, fileContent != nil)
-	return exists
+	return exists, nil
 }
 
-// DiscoverRepos discovers repositories in an organization that have deployment/k8s/<env> paths
-func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, defaultBranch string) ([]string, error) {
+// DiscoverRepos discovers repositories in an organization that pass filter and have deployment/k8s/<env> paths
+// If some repositories cannot be probed, the repositories that were confirmed
+// are returned together with an error describing the failed probes
+func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, defaultBranch string, filter scm.RepoFilter) ([]scm.Repository, error) {
 	log.Printf("Discovering repos for org: %s, envs: %v", org, envs)
 
-	var allRepos []string
+	gh, err := c.clientFor(ctx, org)
+	if err != nil {
+		return nil, err
+	}
 
 	// List all repos in the organization
+	var repoNames []string
 	opt := &github.RepositoryListByOrgOptions{
 		Type:        "all",
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
 
 	for {
-		repos, resp, err := c.client.Repositories.ListByOrg(ctx, org, opt)
+		repos, resp, err := gh.Repositories.ListByOrg(ctx, org, opt)
 		if err != nil {
 			log.Printf("Error listing repos for org %s: %v", org, err)
-			return nil, fmt.Errorf("failed to list repos for org %s: %w", org, err)
+			return nil, fmt.Errorf("failed to list repos for org %s: %w", org, wrapNotFound(err))
 		}
 
 		log.Printf("Found %d repos in org %s (page %d)", len(repos), org, opt.Page)
@@ -168,26 +477,22 @@ func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, d
 			if repo.Name == nil {
 				continue
 			}
-
-			repoName := *repo.Name
-			log.Printf("Checking repo: %s/%s", org, repoName)
-
-			// Check if repo has any of the required env paths
-			hasEnvPath := false
-			for _, env := range envs {
-				path := fmt.Sprintf("deployment/k8s/%s", env)
-				exists := c.HasPath(ctx, org, repoName, defaultBranch, path)
-				log.Printf("  Path %s exists: %v", path, exists)
-				if exists {
-					hasEnvPath = true
-					break
-				}
+			if !filter.MatchesName(org, *repo.Name) {
+				log.Printf("Skipping repo %s/%s: excluded by repository patterns", org, *repo.Name)
+				continue
 			}
-
-			if hasEnvPath {
-				log.Printf("  Adding repo: %s/%s", org, repoName)
-				allRepos = append(allRepos, repoName)
+			// The listing carries the metadata, so filtered repos cost no further requests
+			if !filter.Matches(scm.RepoMetadata{
+				Topics:     repo.Topics,
+				Visibility: repo.GetVisibility(),
+				Archived:   repo.GetArchived(),
+				Fork:       repo.GetFork(),
+				PushedAt:   repo.GetPushedAt().Time,
+			}) {
+				log.Printf("Skipping repo %s/%s: excluded by repository filter", org, *repo.Name)
+				continue
 			}
+			repoNames = append(repoNames, *repo.Name)
 		}
 
 		if resp.NextPage == 0 {
@@ -196,13 +501,64 @@ func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, d
 		opt.Page = resp.NextPage
 	}
 
+	// Check repos concurrently; results are kept by index to preserve the listing order
+	matches := make([]bool, len(repoNames))
+	errs := make([]error, len(repoNames))
+	err = pool.ForEach(ctx, len(repoNames), func(ctx context.Context, i int) error {
+		repoName := repoNames[i]
+		log.Printf("Checking repo: %s/%s", org, repoName)
+
+		// Check if repo has any of the required env paths
+		var checkErrs []error
+		for _, env := range envs {
+			path := fmt.Sprintf("deployment/k8s/%s", env)
+			exists, err := c.HasPath(ctx, org, repoName, defaultBranch, path)
+			if err != nil {
+				checkErrs = append(checkErrs, err)
+				continue
+			}
+			log.Printf("  Path %s exists: %v", path, exists)
+			if exists {
+				matches[i] = true
+				break
+			}
+		}
+		errs[i] = errors.Join(checkErrs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var allRepos []scm.Repository
+	for i, repoName := range repoNames {
+		if matches[i] {
+			log.Printf("  Adding repo: %s/%s", org, repoName)
+			allRepos = append(allRepos, scm.Repository{
+				Owner: org,
+				Name:  repoName,
+				URL:   c.RepoURL(org, repoName),
+			})
+		}
+	}
+
 	log.Printf("Total repos found for org %s: %d", org, len(allRepos))
-	return allRepos, nil
+	return allRepos, errors.Join(errs...)
 }
 
-// hasValuesYaml checks if a directory contains values.yaml
-func (c *Client) hasValuesYaml(ctx context.Context, owner, repo, branch, chartPath string) bool {
-	valuesYaml := fmt.Sprintf("%s/values.yaml", chartPath)
-	return c.HasPath(ctx, owner, repo, branch, valuesYaml)
+// checkExists returns an error wrapping scm.ErrNotFound when the repository
+// tree shows that path is absent, saving a Contents API request
+func (c *Client) checkExists(ctx context.Context, owner, repo, branch, path string) error {
+	tree, err := c.tree(ctx, owner, repo, branch)
+	if err != nil {
+		if scm.IsNotFound(err) {
+			return err
+		}
+		// Let the Contents API request decide
+		return nil
+	}
+	if !tree.HasPath(path) {
+		return fmt.Errorf("%s: %w", path, scm.ErrNotFound)
+	}
+	return nil
 }
-
@@ -0,0 +1,35 @@
+package github
+
+import "testing"
+
+func TestParseRepoURL(t *testing.T) {
+	c, err := newClient(WithEnterpriseURLs("https://github.example.com/api/v3/", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		"git@github.example.com:acme/app.git",
+		"https://github.example.com/acme/app",
+		"ssh://git@GitHub.example.com/acme/app.git",
+	} {
+		owner, repo, err := c.ParseRepoURL(url)
+		if err != nil {
+			t.Errorf("%s: %v", url, err)
+			continue
+		}
+		if owner != "acme" || repo != "app" {
+			t.Errorf("%s: got %s/%s, want acme/app", url, owner, repo)
+		}
+	}
+
+	for _, url := range []string{
+		"git@github.com:acme/app.git",
+		"https://gitlab.example.com/acme/app.git",
+		"https://github.example.com/acme/team/app.git",
+	} {
+		if owner, repo, err := c.ParseRepoURL(url); err == nil {
+			t.Errorf("%s: got %s/%s, want an error", url, owner, repo)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/metrics"
+)
+
+var rateLimitWaits = metrics.NewCounter("scm_plugin_github_rate_limit_waits_total",
+	"GitHub requests delayed because the remaining rate-limit budget was low")
+
+// rateLimitTransport tracks the X-RateLimit-* headers of one token and paces
+// requests once fewer than reserve calls remain: the remaining budget is
+// spread over the time left until the limit resets, and requests wait for the
+// reset once it is exhausted or a Retry-After was received.
+type rateLimitTransport struct {
+	reserve int
+	next    http.RoundTripper
+
+	mu        sync.Mutex
+	remaining int // -1 until the first response
+	reset     time.Time
+}
+
+func newRateLimitTransport(reserve int, next http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{reserve: reserve, next: next, remaining: -1}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.delay(); delay > 0 {
+		rateLimitWaits.Inc()
+		log.Printf("Warning: GitHub rate limit low, delaying %s by %s", req.URL.Path, delay.Round(time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.update(resp)
+	return resp, nil
+}
+
+// delay returns how long the next request should wait and reserves a call
+// from the budget so concurrent requests do not all see the same count
+func (t *rateLimitTransport) delay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.remaining < 0 || t.remaining > t.reserve {
+		return 0
+	}
+	untilReset := time.Until(t.reset)
+	if untilReset <= 0 {
+		// The window has reset; the next response reports the new budget
+		t.remaining = -1
+		return 0
+	}
+
+	remaining := t.remaining
+	if t.remaining > 0 {
+		t.remaining--
+	}
+	if remaining == 0 {
+		return untilReset
+	}
+	return untilReset / time.Duration(remaining+1)
+}
+
+// update records the budget reported by a response
+func (t *rateLimitTransport) update(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Secondary rate limits only send Retry-After (seconds)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil &&
+		(resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) {
+		t.remaining = 0
+		t.reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		return
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		// GitHub Enterprise Server with rate limiting disabled sends no headers
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	t.remaining = remaining
+	t.reset = time.Unix(reset, 0)
+}
@@ -0,0 +1,116 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestRateLimitTransportPacing(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(100*time.Second).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		remaining string
+		// bounds of the first delay
+		min, max time.Duration
+	}{
+		{"above reserve", "500", 0, 0},
+		{"at reserve", "10", 100 * time.Second / 12, 100 * time.Second / 11},
+		{"low", "1", 98 * time.Second / 2, 100 * time.Second / 2},
+		{"exhausted", "0", 98 * time.Second, 100 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newRateLimitTransport(10, nil)
+			if d := rt.delay(); d != 0 {
+				t.Fatalf("delay before any response = %s, want 0", d)
+			}
+			rt.update(rateLimitResponse(http.StatusOK, map[string]string{
+				"X-RateLimit-Remaining": tt.remaining,
+				"X-RateLimit-Reset":     reset,
+			}))
+			if d := rt.delay(); d < tt.min || d > tt.max {
+				t.Errorf("delay = %s, want between %s and %s", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportReservesCalls(t *testing.T) {
+	rt := newRateLimitTransport(10, nil)
+	rt.update(rateLimitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "3",
+		"X-RateLimit-Reset":     strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10),
+	}))
+
+	// Concurrent requests each take a call, so later ones wait longer
+	var last time.Duration
+	for i := 0; i < 4; i++ {
+		d := rt.delay()
+		if d <= last {
+			t.Fatalf("delay %d = %s, want more than %s", i, d, last)
+		}
+		last = d
+	}
+	if last < 58*time.Second {
+		t.Errorf("the exhausted budget should wait for the reset, got %s", last)
+	}
+}
+
+func TestRateLimitTransportRetryAfter(t *testing.T) {
+	rt := newRateLimitTransport(10, nil)
+	// Retry-After only counts on throttled responses
+	rt.update(rateLimitResponse(http.StatusOK, map[string]string{"Retry-After": "30"}))
+	if d := rt.delay(); d != 0 {
+		t.Errorf("delay after a 200 = %s, want 0", d)
+	}
+
+	rt.update(rateLimitResponse(http.StatusForbidden, map[string]string{"Retry-After": "30"}))
+	if d := rt.delay(); d < 29*time.Second || d > 30*time.Second {
+		t.Errorf("delay after a secondary rate limit = %s, want about 30s", d)
+	}
+
+	rt = newRateLimitTransport(10, nil)
+	rt.update(rateLimitResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "0"}))
+	if d := rt.delay(); d != 0 {
+		t.Errorf("delay after Retry-After 0 = %s, want 0", d)
+	}
+	if rt.remaining != -1 {
+		t.Errorf("remaining = %d, want the budget forgotten after the reset", rt.remaining)
+	}
+}
+
+func TestRateLimitTransportWaitCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRateLimitTransport(10, http.DefaultTransport)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the wait to end with the request context", err)
+	}
+}
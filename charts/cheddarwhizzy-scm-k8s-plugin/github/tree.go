@@ -0,0 +1,146 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/google/go-github/v57/github"
+)
+
+// errTreeTruncated is returned when GitHub truncated a recursive tree
+// (over 100,000 entries or 7 MB); callers fall back to the Contents API
+var errTreeTruncated = errors.New("repository tree is truncated")
+
+// treeEntry is a fetched tree snapshot
+type treeEntry struct {
+	tree      *scm.Tree
+	err       error
+	fetchedAt time.Time
+}
+
+// treeCache holds one recursive tree per (owner, repo, ref) for a short TTL,
+// so a generation run answers all path questions for a repo from one request.
+// Expired trees are dropped whenever a tree is stored.
+type treeCache struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*treeEntry
+	inflight map[string]*treeFetch
+}
+
+// treeFetch lets concurrent callers share one request for the same tree
+type treeFetch struct {
+	done chan struct{}
+	tree *scm.Tree
+	err  error
+}
+
+func newTreeCache(ttl time.Duration) *treeCache {
+	return &treeCache{
+		ttl:      ttl,
+		entries:  make(map[string]*treeEntry),
+		inflight: make(map[string]*treeFetch),
+	}
+}
+
+// tree returns the recursive tree of a repository at ref via the Git Trees API
+func (c *Client) tree(ctx context.Context, owner, repo, ref string) (*scm.Tree, error) {
+	key := treeKey(owner, repo, ref)
+
+	c.trees.mu.Lock()
+	entry, exists := c.trees.entries[key]
+	if exists && time.Since(entry.fetchedAt) < c.trees.ttl {
+		c.trees.mu.Unlock()
+		return entry.tree, entry.err
+	}
+	if fetch, exists := c.trees.inflight[key]; exists {
+		c.trees.mu.Unlock()
+		select {
+		case <-fetch.done:
+			// The fetching request was cancelled, not ours: try again
+			if ctx.Err() == nil && (errors.Is(fetch.err, context.Canceled) || errors.Is(fetch.err, context.DeadlineExceeded)) {
+				return c.tree(ctx, owner, repo, ref)
+			}
+			return fetch.tree, fetch.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	fetch := &treeFetch{done: make(chan struct{})}
+	c.trees.inflight[key] = fetch
+	c.trees.mu.Unlock()
+
+	fetch.tree, fetch.err = c.fetchTree(ctx, owner, repo, ref)
+
+	c.trees.mu.Lock()
+	delete(c.trees.inflight, key)
+	// Transient failures are not cached
+	if fetch.err == nil || scm.IsNotFound(fetch.err) || errors.Is(fetch.err, errTreeTruncated) {
+		c.trees.store(key, &treeEntry{tree: fetch.tree, err: fetch.err, fetchedAt: time.Now()})
+	}
+	c.trees.mu.Unlock()
+	close(fetch.done)
+
+	return fetch.tree, fetch.err
+}
+
+// fetchTree requests the recursive tree for ref
+func (c *Client) fetchTree(ctx context.Context, owner, repo, ref string) (*scm.Tree, error) {
+	gh, err := c.clientFor(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	gitTree, _, err := gh.Git.GetTree(ctx, owner, repo, ref, true)
+	if err != nil {
+		// Empty repositories answer 409 Conflict
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusConflict {
+			return nil, fmt.Errorf("tree of %s/%s@%s: %w", owner, repo, ref, scm.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get tree of %s/%s@%s: %w", owner, repo, ref, wrapNotFound(err))
+	}
+	if gitTree.GetTruncated() {
+		log.Printf("Tree of %s/%s@%s is truncated, falling back to the Contents API", owner, repo, ref)
+		return nil, errTreeTruncated
+	}
+
+	files := make([]string, 0, len(gitTree.Entries))
+	for _, entry := range gitTree.Entries {
+		// Directories are implied by file paths; submodules ("commit") are skipped
+		if entry.GetType() == "blob" {
+			files = append(files, entry.GetPath())
+		}
+	}
+	return scm.NewTree(files), nil
+}
+
+// store caches entry under key and drops expired trees; the caller holds the lock
+func (tc *treeCache) store(key string, entry *treeEntry) {
+	for k, e := range tc.entries {
+		if time.Since(e.fetchedAt) >= tc.ttl {
+			delete(tc.entries, k)
+		}
+	}
+	tc.entries[key] = entry
+}
+
+// invalidate drops the tree cached for a repository at ref
+func (tc *treeCache) invalidate(owner, repo, ref string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	delete(tc.entries, treeKey(owner, repo, ref))
+}
+
+// treeKey builds the cache key of a tree; owner and repo are case-insensitive on GitHub
+func treeKey(owner, repo, ref string) string {
+	return strings.ToLower(owner+"/"+repo) + "@" + ref
+}
@@ -0,0 +1,27 @@
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+)
+
+func TestTreeCacheStoreDropsExpired(t *testing.T) {
+	tc := newTreeCache(time.Minute)
+	tc.store(treeKey("acme", "shop", "feature"), &treeEntry{tree: scm.NewTree(nil), fetchedAt: time.Now().Add(-2 * time.Minute)})
+	tc.store(treeKey("acme", "shop", "main"), &treeEntry{tree: scm.NewTree(nil), fetchedAt: time.Now().Add(-30 * time.Second)})
+	tc.store(treeKey("acme", "api", "main"), &treeEntry{tree: scm.NewTree(nil), fetchedAt: time.Now()})
+
+	if _, ok := tc.entries[treeKey("acme", "shop", "feature")]; ok {
+		t.Error("expired tree was kept")
+	}
+	if len(tc.entries) != 2 {
+		t.Errorf("cached %d trees, want the 2 fresh ones", len(tc.entries))
+	}
+
+	tc.invalidate("ACME", "Shop", "main")
+	if _, ok := tc.entries[treeKey("acme", "shop", "main")]; ok || len(tc.entries) != 1 {
+		t.Errorf("invalidate left %d trees, want only acme/api", len(tc.entries))
+	}
+}
@@ -0,0 +1,404 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/pool"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Client reads repositories from a GitLab instance using the REST API v4
+type Client struct {
+	baseURL    string
+	host       string
+	token      string
+	httpClient *http.Client
+	// requests are paced once fewer calls than this remain in the rate limit
+	rateLimitReserve int
+}
+
+// Client implements scm.Provider
+var _ scm.Provider = (*Client)(nil)
+
+// treeEntry is an item returned by the repository tree API
+type treeEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "tree" or "blob"
+	Path string `json:"path"`
+}
+
+// project is the subset of the projects API response used for discovery
+type project struct {
+	Path          string    `json:"path"`
+	SSHURLToRepo  string    `json:"ssh_url_to_repo"`
+	DefaultBranch string    `json:"default_branch"`
+	Topics        []string  `json:"topics"`
+	TagList       []string  `json:"tag_list"` // topics before GitLab 14.0
+	Visibility    string    `json:"visibility"`
+	Archived      bool      `json:"archived"`
+	LastActivity  time.Time `json:"last_activity_at"`
+	ForkedFrom    *struct {
+		ID int `json:"id"`
+	} `json:"forked_from_project"`
+	Namespace struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+}
+
+// metadata returns the fields a scm.RepoFilter looks at
+func (p project) metadata() scm.RepoMetadata {
+	topics := p.Topics
+	if len(topics) == 0 {
+		topics = p.TagList
+	}
+	return scm.RepoMetadata{
+		Topics:     topics,
+		Visibility: p.Visibility,
+		Archived:   p.Archived,
+		Fork:       p.ForkedFrom != nil,
+		PushedAt:   p.LastActivity,
+	}
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithRateLimitReserve sets the remaining rate-limit budget below which
+// requests are spread out until the limit resets (0 only waits when exhausted)
+func WithRateLimitReserve(reserve int) Option {
+	return func(c *Client) {
+		c.rateLimitReserve = reserve
+	}
+}
+
+// NewClient creates a new GitLab client for the instance at baseURL (e.g. https://gitlab.com)
+func NewClient(baseURL, token string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid GitLab URL %q", baseURL)
+	}
+	c := &Client{
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
+		host:             parsed.Hostname(),
+		token:            token,
+		rateLimitReserve: 100,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient = &http.Client{Transport: newRateLimitTransport(c.rateLimitReserve, http.DefaultTransport)}
+	return c, nil
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return "gitlab"
+}
+
+// RepoURL builds the SSH clone URL for a project
+func (c *Client) RepoURL(owner, repo string) string {
+	return fmt.Sprintf("git@%s:%s/%s.git", c.host, owner, repo)
+}
+
+// ParseRepoURL extracts the (sub)group path and project name from a GitLab URL
+func (c *Client) ParseRepoURL(repoURL string) (string, string, error) {
+	host, owner, repo, err := utils.ParseRepoURLWithHost(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	if host != c.host {
+		return "", "", fmt.Errorf("URL %s does not belong to GitLab instance %s", repoURL, c.host)
+	}
+	return owner, repo, nil
+}
+
+// ReadProjectInfo reads project-info.yaml from a repository
+func (c *Client) ReadProjectInfo(ctx context.Context, owner, repo, branch string) (*types.ProjectInfo, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, "project-info.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project-info.yaml: %w", err)
+	}
+
+	var projectInfo types.ProjectInfo
+	if err := yaml.Unmarshal(content, &projectInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse project-info.yaml: %w", err)
+	}
+
+	return &projectInfo, nil
+}
+
+// ReadArgoCDConfig reads argocd-config.yaml from a chart directory
+func (c *Client) ReadArgoCDConfig(ctx context.Context, owner, repo, branch, chartPath string) (*types.ArgoCDConfig, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, fmt.Sprintf("%s/argocd-config.yaml", chartPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get argocd-config.yaml: %w", err)
+	}
+
+	var argocdConfig types.ArgoCDConfig
+	if err := yaml.Unmarshal(content, &argocdConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse argocd-config.yaml: %w", err)
+	}
+
+	return &argocdConfig, nil
+}
+
+// ReadFile returns the content of a file
+func (c *Client) ReadFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// DiscoverCharts discovers chart directories in a given path
+func (c *Client) DiscoverCharts(ctx context.Context, owner, repo, branch, envPath string) ([]string, error) {
+	entries, err := c.listTree(ctx, owner, repo, branch, envPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contents of %s: %w", envPath, err)
+	}
+
+	var dirs []treeEntry
+	for _, entry := range entries {
+		if entry.Type == "tree" && !strings.HasPrefix(entry.Name, ".") {
+			dirs = append(dirs, entry)
+		}
+	}
+
+	// Check if each directory is a valid chart (has values.yaml or a kustomization - indicates env-specific override exists)
+	valid := make([]bool, len(dirs))
+	errs := make([]error, len(dirs))
+	err = pool.ForEach(ctx, len(dirs), func(ctx context.Context, i int) error {
+		files, err := c.ListChartFiles(ctx, owner, repo, branch, dirs[i].Path)
+		valid[i], errs[i] = scm.IsChartDir(files), err
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []string
+	for i, dir := range dirs {
+		if valid[i] {
+			charts = append(charts, dir.Name)
+		}
+	}
+
+	return charts, errors.Join(errs...)
+}
+
+// ListChartFiles lists all files in a chart directory and returns a map of filename -> exists
+func (c *Client) ListChartFiles(ctx context.Context, owner, repo, branch, chartDirPath string) (map[string]bool, error) {
+	fileMap := make(map[string]bool)
+
+	entries, err := c.listTree(ctx, owner, repo, branch, chartDirPath)
+	if err != nil {
+		// If the directory doesn't exist, return empty map
+		if scm.IsNotFound(err) {
+			return fileMap, nil
+		}
+		return fileMap, fmt.Errorf("failed to list %s: %w", chartDirPath, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Type == "blob" {
+			fileMap[entry.Name] = true
+		}
+	}
+
+	return fileMap, nil
+}
+
+// HasPath checks if a path exists in a repository
+func (c *Client) HasPath(ctx context.Context, owner, repo, branch, path string) (bool, error) {
+	// Directories: git has no empty directories, so any entry means the path exists
+	entries, err := c.listTree(ctx, owner, repo, branch, path)
+	if err == nil && len(entries) > 0 {
+		return true, nil
+	}
+	if err != nil && !scm.IsNotFound(err) {
+		return false, fmt.Errorf("failed to check %s in %s/%s: %w", path, owner, repo, err)
+	}
+
+	// Files
+	_, err = c.readFile(ctx, owner, repo, branch, path)
+	if err == nil {
+		return true, nil
+	}
+	if scm.IsNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s in %s/%s: %w", path, owner, repo, err)
+}
+
+// DiscoverRepos discovers projects in a group and all of its subgroups that pass filter and have deployment/k8s/<env> paths.
+// A defaultBranch of HEAD probes each project's own default branch.
+func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, defaultBranch string, filter scm.RepoFilter) ([]scm.Repository, error) {
+	log.Printf("Discovering GitLab projects for group: %s, envs: %v", org, envs)
+
+	listed, err := c.listProjects(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects for group %s: %w", org, err)
+	}
+
+	var projects []project
+	for _, p := range listed {
+		if !filter.MatchesName(p.Namespace.FullPath, p.Path) {
+			log.Printf("Skipping project %s/%s: excluded by repository patterns", p.Namespace.FullPath, p.Path)
+			continue
+		}
+		if !filter.Matches(p.metadata()) {
+			log.Printf("Skipping project %s/%s: excluded by repository filter", p.Namespace.FullPath, p.Path)
+			continue
+		}
+		projects = append(projects, p)
+	}
+
+	// Check projects concurrently; results are kept by index to preserve the listing order
+	matches := make([]bool, len(projects))
+	errs := make([]error, len(projects))
+	err = pool.ForEach(ctx, len(projects), func(ctx context.Context, i int) error {
+		p := projects[i]
+		branch := defaultBranch
+		if branch == "HEAD" && p.DefaultBranch != "" {
+			branch = p.DefaultBranch
+		}
+		var checkErrs []error
+		for _, env := range envs {
+			exists, err := c.HasPath(ctx, p.Namespace.FullPath, p.Path, branch, fmt.Sprintf("deployment/k8s/%s", env))
+			if err != nil {
+				checkErrs = append(checkErrs, err)
+				continue
+			}
+			if exists {
+				matches[i] = true
+				break
+			}
+		}
+		errs[i] = errors.Join(checkErrs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var allRepos []scm.Repository
+	for i, p := range projects {
+		owner := p.Namespace.FullPath
+		if matches[i] {
+			repoURL := p.SSHURLToRepo
+			if repoURL == "" {
+				repoURL = c.RepoURL(owner, p.Path)
+			}
+			log.Printf("  Adding project: %s/%s", owner, p.Path)
+			allRepos = append(allRepos, scm.Repository{Owner: owner, Name: p.Path, URL: repoURL})
+		}
+	}
+
+	log.Printf("Total projects found for group %s: %d", org, len(allRepos))
+	return allRepos, errors.Join(errs...)
+}
+
+// listProjects lists the projects of a group including subgroups, falling back to a user namespace
+func (c *Client) listProjects(ctx context.Context, namespace string) ([]project, error) {
+	query := url.Values{"include_subgroups": {"true"}}
+	projects, err := paginate[project](ctx, c, "/groups/"+url.PathEscape(namespace)+"/projects", query)
+	if scm.IsNotFound(err) {
+		return paginate[project](ctx, c, "/users/"+url.PathEscape(namespace)+"/projects", nil)
+	}
+	return projects, err
+}
+
+// listTree lists the entries of a directory
+func (c *Client) listTree(ctx context.Context, owner, repo, branch, path string) ([]treeEntry, error) {
+	query := url.Values{"path": {path}, "ref": {branch}}
+	return paginate[treeEntry](ctx, c, "/projects/"+projectID(owner, repo)+"/repository/tree", query)
+}
+
+// readFile returns the raw content of a file
+func (c *Client) readFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/projects/%s/repository/files/%s/raw", projectID(owner, repo), url.PathEscape(path))
+	resp, err := c.get(ctx, endpoint, url.Values{"ref": {branch}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// paginate follows X-Next-Page headers and decodes every page into a single slice
+func paginate[T any](ctx context.Context, c *Client, endpoint string, query url.Values) ([]T, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("per_page", "100")
+
+	var all []T
+	for page := 1; page > 0; {
+		query.Set("page", strconv.Itoa(page))
+		resp, err := c.get(ctx, endpoint, query)
+		if err != nil {
+			return nil, err
+		}
+
+		var items []T
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", endpoint, err)
+		}
+		all = append(all, items...)
+
+		page, _ = strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	}
+	return all, nil
+}
+
+// get performs an authenticated GET request; 404 responses wrap scm.ErrNotFound
+func (c *Client) get(ctx context.Context, endpoint string, query url.Values) (*http.Response, error) {
+	reqURL := c.baseURL + "/api/v4" + endpoint
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", endpoint, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("GET %s: %w", endpoint, scm.ErrNotFound)
+	}
+	return nil, fmt.Errorf("GET %s: unexpected status %d: %s", endpoint, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// projectID returns the URL-encoded full path used as project ID
+func projectID(owner, repo string) string {
+	return url.PathEscape(owner + "/" + repo)
+}
@@ -0,0 +1,214 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+)
+
+// fakeGitLab serves the API v4 endpoints the client reads
+type fakeGitLab struct {
+	// pages of projects per listing endpoint path
+	projects map[string][][]project
+	// tree entries and file contents per "<project>@<ref>:<path>"
+	trees map[string][]treeEntry
+	files map[string]string
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("PRIVATE-TOKEN") != "token" {
+		http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+
+	if pages, ok := f.projects[r.URL.Path]; ok {
+		if strings.HasPrefix(r.URL.Path, "/api/v4/groups/") && query.Get("include_subgroups") != "true" {
+			http.Error(w, "subgroups not requested", http.StatusBadRequest)
+			return
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		if page < len(pages) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		json.NewEncoder(w).Encode(pages[page-1])
+		return
+	}
+
+	// /api/v4/projects/<url-encoded full path>/repository/...
+	escaped, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/v4/projects/")
+	if ok {
+		id, rest, _ := strings.Cut(escaped, "/")
+		id, _ = url.PathUnescape(id)
+		key := id + "@" + query.Get("ref") + ":"
+		if rest == "repository/tree" {
+			if entries, ok := f.trees[key+query.Get("path")]; ok {
+				json.NewEncoder(w).Encode(entries)
+				return
+			}
+		}
+		if file, ok := strings.CutPrefix(rest, "repository/files/"); ok && strings.HasSuffix(file, "/raw") {
+			file, _ = url.PathUnescape(strings.TrimSuffix(file, "/raw"))
+			if content, ok := f.files[key+file]; ok {
+				w.Write([]byte(content))
+				return
+			}
+		}
+	}
+	http.Error(w, `{"message":"404 Not Found"}`, http.StatusNotFound)
+}
+
+func newTestClient(t *testing.T, fake *fakeGitLab) *Client {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	c, err := NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testProject(namespace, path, defaultBranch string) project {
+	p := project{Path: path, DefaultBranch: defaultBranch}
+	p.Namespace.FullPath = namespace
+	return p
+}
+
+func TestDiscoverRepos(t *testing.T) {
+	envDir := []treeEntry{{Name: "api", Type: "tree", Path: "deployment/k8s/prod/api"}}
+	fake := &fakeGitLab{
+		projects: map[string][][]project{
+			// Two pages, including a project of a subgroup
+			"/api/v4/groups/acme/projects": {
+				{testProject("acme", "shop", "main"), testProject("acme", "docs", "main")},
+				{testProject("acme/team", "billing", "main")},
+			},
+			// alice is a user, not a group
+			"/api/v4/users/alice/projects": {
+				{testProject("alice", "blog", "trunk")},
+			},
+		},
+		trees: map[string][]treeEntry{
+			"acme/shop@main:deployment/k8s/prod":         envDir,
+			"acme/team/billing@main:deployment/k8s/prod": envDir,
+			"alice/blog@trunk:deployment/k8s/prod":       envDir,
+		},
+	}
+	c := newTestClient(t, fake)
+
+	repos, err := c.DiscoverRepos(context.Background(), "acme", []string{"prod"}, "main", scm.RepoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scm.Repository{
+		{Owner: "acme", Name: "shop", URL: "git@127.0.0.1:acme/shop.git"},
+		{Owner: "acme/team", Name: "billing", URL: "git@127.0.0.1:acme/team/billing.git"},
+	}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("group: got %+v, want %+v", repos, want)
+	}
+
+	// HEAD probes the default branch of each project
+	repos, err = c.DiscoverRepos(context.Background(), "alice", []string{"prod"}, "HEAD", scm.RepoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Owner != "alice" || repos[0].Name != "blog" {
+		t.Errorf("user namespace: got %+v, want alice/blog", repos)
+	}
+
+	if _, err := c.DiscoverRepos(context.Background(), "nobody", []string{"prod"}, "main", scm.RepoFilter{}); !scm.IsNotFound(err) {
+		t.Errorf("unknown namespace: got %v, want a not found error", err)
+	}
+}
+
+func TestReadFiles(t *testing.T) {
+	fake := &fakeGitLab{
+		trees: map[string][]treeEntry{
+			"acme/shop@main:deployment/k8s/prod/api": {
+				{Name: "values.yaml", Type: "blob", Path: "deployment/k8s/prod/api/values.yaml"},
+				{Name: "templates", Type: "tree", Path: "deployment/k8s/prod/api/templates"},
+			},
+		},
+		files: map[string]string{
+			"acme/shop@main:project-info.yaml":                             "deployment:\n  namespace: shop\n",
+			"acme/shop@main:deployment/k8s/prod/api/argocd-config.yaml":    "syncOptions: [CreateNamespace=true]\n",
+			"acme/shop@main:deployment/k8s/prod/api/values.yaml":           "replicas: 2\n",
+			"acme/shop@main:deployment/k8s/prod/broken/argocd-config.yaml": "syncOptions: [\n",
+		},
+	}
+	c := newTestClient(t, fake)
+	ctx := context.Background()
+
+	data, err := c.ReadFile(ctx, "acme", "shop", "main", "deployment/k8s/prod/api/values.yaml")
+	if err != nil || string(data) != "replicas: 2\n" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if _, err := c.ReadFile(ctx, "acme", "shop", "main", "missing.yaml"); !scm.IsNotFound(err) {
+		t.Errorf("missing file: got %v, want a not found error", err)
+	}
+
+	info, err := c.ReadProjectInfo(ctx, "acme", "shop", "main")
+	if err != nil || info.Deployment.Namespace != "shop" {
+		t.Errorf("ReadProjectInfo = %+v, %v", info, err)
+	}
+
+	argocdConfig, err := c.ReadArgoCDConfig(ctx, "acme", "shop", "main", "deployment/k8s/prod/api")
+	if err != nil || !reflect.DeepEqual(argocdConfig.SyncOptions, []string{"CreateNamespace=true"}) {
+		t.Errorf("ReadArgoCDConfig = %+v, %v", argocdConfig, err)
+	}
+	if _, err := c.ReadArgoCDConfig(ctx, "acme", "shop", "main", "deployment/k8s/prod/broken"); err == nil || scm.IsNotFound(err) {
+		t.Errorf("invalid argocd-config.yaml: got %v, want a parse error", err)
+	}
+
+	files, err := c.ListChartFiles(ctx, "acme", "shop", "main", "deployment/k8s/prod/api")
+	if err != nil || !reflect.DeepEqual(files, map[string]bool{"values.yaml": true}) {
+		t.Errorf("ListChartFiles = %v, %v", files, err)
+	}
+	files, err = c.ListChartFiles(ctx, "acme", "shop", "main", "deployment/k8s/prod/missing")
+	if err != nil || len(files) != 0 {
+		t.Errorf("missing directory: ListChartFiles = %v, %v", files, err)
+	}
+
+	for path, want := range map[string]bool{
+		"deployment/k8s/prod/api":             true,
+		"deployment/k8s/prod/api/values.yaml": true,
+		"deployment/k8s/qa":                   false,
+	} {
+		if exists, err := c.HasPath(ctx, "acme", "shop", "main", path); err != nil || exists != want {
+			t.Errorf("HasPath(%s) = %v, %v; want %v", path, exists, err, want)
+		}
+	}
+}
+
+func TestUnexpectedStatus(t *testing.T) {
+	c := newTestClient(t, &fakeGitLab{})
+	c.token = "wrong"
+	_, err := c.ReadFile(context.Background(), "acme", "shop", "main", "values.yaml")
+	if err == nil || scm.IsNotFound(err) || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want an unexpected status error", err)
+	}
+}
+
+func TestParseRepoURL(t *testing.T) {
+	c, err := NewClient("https://gitlab.example.com", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, repo, err := c.ParseRepoURL("git@gitlab.example.com:acme/team/billing.git")
+	if err != nil || owner != "acme/team" || repo != "billing" {
+		t.Errorf("got %q %q %v, want acme/team billing", owner, repo, err)
+	}
+	if _, _, err := c.ParseRepoURL("git@github.com:acme/shop.git"); err == nil {
+		t.Error("other host: expected an error")
+	}
+}
@@ -0,0 +1,63 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	var headers http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(server.URL, "token", WithRateLimitReserve(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := c.httpClient.Transport.(*rateLimitTransport)
+	get := func() {
+		t.Helper()
+		// Start from a fresh budget so the request itself is not paced
+		rt.remaining = -1
+		if resp, err := c.get(context.Background(), "/version", nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+	reset := strconv.FormatInt(time.Now().Add(100*time.Second).Unix(), 10)
+
+	// Instances with rate limiting disabled are never paced
+	get()
+	if d := rt.delay(); d != 0 {
+		t.Errorf("delay without headers = %s, want 0", d)
+	}
+
+	headers = http.Header{"Ratelimit-Remaining": {"500"}, "Ratelimit-Reset": {reset}}
+	get()
+	if d := rt.delay(); d != 0 {
+		t.Errorf("delay above the reserve = %s, want 0", d)
+	}
+
+	headers = http.Header{"Ratelimit-Remaining": {"4"}, "Ratelimit-Reset": {reset}}
+	get()
+	if d := rt.delay(); d < 98*time.Second/5 || d > 100*time.Second/5 {
+		t.Errorf("delay with 4 calls left = %s, want about 20s", d)
+	}
+
+	headers = http.Header{"Retry-After": {"30"}}
+	status = http.StatusTooManyRequests
+	get()
+	if d := rt.delay(); d < 29*time.Second || d > 30*time.Second {
+		t.Errorf("delay after a 429 = %s, want about 30s", d)
+	}
+}
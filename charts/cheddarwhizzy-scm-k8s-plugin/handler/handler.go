@@ -3,6 +3,7 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -62,10 +63,16 @@ func (h *Handler) HandleGenerate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate parameters
-	parameters, err := h.generator.GenerateParameters(input.Input.Parameters)
+	parameters, err := h.generator.GenerateParameters(r.Context(), input.Input.Parameters)
 	if err != nil {
 		log.Printf("Failed to generate parameters: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to generate parameters: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		// Invalid files committed to a repository are reported to the caller
+		var validationErr *generator.ValidationError
+		if errors.As(err, &validationErr) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, fmt.Sprintf("Failed to generate parameters: %v", err), status)
 		return
 	}
 
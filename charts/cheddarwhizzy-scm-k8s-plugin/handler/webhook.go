@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/metrics"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+)
+
+// maxWebhookPayload is the largest payload GitHub delivers (25 MB)
+const maxWebhookPayload = 25 << 20
+
+var webhookPushes = metrics.NewCounter("scm_plugin_webhook_push_events_total",
+	"Verified GitHub push events that invalidated cached data")
+
+// forwardedHeaders are copied when forwarding an event to ArgoCD
+var forwardedHeaders = []string{"Content-Type", "User-Agent", "X-GitHub-Event", "X-GitHub-Delivery", "X-Hub-Signature", "X-Hub-Signature-256"}
+
+// pushEvent is the subset of the GitHub push event payload used for invalidation
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		Name          string `json:"name"`
+		DefaultBranch string `json:"default_branch"`
+		Owner         struct {
+			Login string `json:"login"`
+			Name  string `json:"name"`
+		} `json:"owner"`
+	} `json:"repository"`
+}
+
+// WebhookHandler receives GitHub push webhooks
+type WebhookHandler struct {
+	cache      scm.Invalidator // usually the generator
+	secret     []byte
+	forwardURL string
+	client     *http.Client
+}
+
+// NewWebhookHandler creates a webhook handler verifying payloads with secret
+// and invalidating cache on pushes. If forwardURL is set (e.g. the
+// ApplicationSet controller's /api/webhook), verified events are forwarded
+// there after invalidation.
+func NewWebhookHandler(cache scm.Invalidator, secret, forwardURL string) *WebhookHandler {
+	return &WebhookHandler{
+		cache:      cache,
+		secret:     []byte(secret),
+		forwardURL: forwardURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// HandleGitHub handles GitHub webhook deliveries
+func (h *WebhookHandler) HandleGitHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// One byte more than allowed tells an oversized payload from one that fits
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookPayload+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookPayload {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !h.validSignature(r.Header.Get("X-Hub-Signature-256"), body) {
+		log.Printf("Rejected webhook delivery %s: invalid signature", r.Header.Get("X-GitHub-Delivery"))
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	switch event {
+	case "ping":
+		w.WriteHeader(http.StatusOK)
+		return
+	case "push":
+	default:
+		log.Printf("Ignoring webhook event %q", event)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decode push event: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	owner := push.Repository.Owner.Login
+	if owner == "" {
+		owner = push.Repository.Owner.Name
+	}
+	if owner == "" || push.Repository.Name == "" || !strings.HasPrefix(push.Ref, "refs/heads/") {
+		// Tag pushes and malformed payloads do not affect generated parameters
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	branch := strings.TrimPrefix(push.Ref, "refs/heads/")
+	log.Printf("Push to %s/%s@%s, invalidating cached data", owner, push.Repository.Name, branch)
+	h.cache.Invalidate(owner, push.Repository.Name, branch)
+	if branch == push.Repository.DefaultBranch {
+		// ApplicationSets may track the default branch as HEAD
+		h.cache.Invalidate(owner, push.Repository.Name, "HEAD")
+	}
+	webhookPushes.Inc()
+
+	if h.forwardURL != "" {
+		go h.forward(r.Header, body)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validSignature checks the X-Hub-Signature-256 header against the payload
+func (h *WebhookHandler) validSignature(signature string, body []byte) bool {
+	if len(h.secret) == 0 || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// forward replays a verified event to the ArgoCD webhook endpoint
+func (h *WebhookHandler) forward(header http.Header, body []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.forwardURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to forward webhook: %v", err)
+		return
+	}
+	for _, name := range forwardedHeaders {
+		if value := header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to forward webhook to %s: %v", h.forwardURL, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Forwarding webhook to %s returned %s", h.forwardURL, resp.Status)
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+// fakeCache records invalidations
+type fakeCache struct {
+	mu          sync.Mutex
+	invalidated []string
+}
+
+func (c *fakeCache) Invalidate(owner, repo, ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated = append(c.invalidated, owner+"/"+repo+"@"+ref)
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func pushPayload(ref string) string {
+	return `{"ref":"` + ref + `","repository":{"name":"shop","default_branch":"main","owner":{"login":"acme"}}}`
+}
+
+func TestHandleGitHub(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		event       string
+		body        string
+		signature   string // defaults to a valid one
+		wantStatus  int
+		wantInvalid []string
+	}{
+		{name: "push to default branch", event: "push", body: pushPayload("refs/heads/main"),
+			wantStatus: http.StatusOK, wantInvalid: []string{"acme/shop@main", "acme/shop@HEAD"}},
+		{name: "push to other branch", event: "push", body: pushPayload("refs/heads/feature"),
+			wantStatus: http.StatusOK, wantInvalid: []string{"acme/shop@feature"}},
+		{name: "tag push", event: "push", body: pushPayload("refs/tags/v1.0.0"), wantStatus: http.StatusAccepted},
+		{name: "ping", event: "ping", body: `{"zen":"hi"}`, wantStatus: http.StatusOK},
+		{name: "other event", event: "issues", body: `{}`, wantStatus: http.StatusAccepted},
+		{name: "malformed push", event: "push", body: `{"ref":`, wantStatus: http.StatusBadRequest},
+		{name: "wrong signature", event: "push", body: pushPayload("refs/heads/main"),
+			signature: sign("other", pushPayload("refs/heads/main")), wantStatus: http.StatusUnauthorized},
+		{name: "missing signature", event: "push", body: pushPayload("refs/heads/main"),
+			signature: "-", wantStatus: http.StatusUnauthorized},
+		{name: "sha1 signature", event: "push", body: pushPayload("refs/heads/main"),
+			signature: "sha1=abcdef", wantStatus: http.StatusUnauthorized},
+		{name: "no secret configured", secret: "-", event: "push", body: pushPayload("refs/heads/main"),
+			signature: sign("", pushPayload("refs/heads/main")), wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := testSecret
+			if tt.secret == "-" {
+				secret = ""
+			}
+			cache := &fakeCache{}
+			h := NewWebhookHandler(cache, secret, "")
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/webhook/github", strings.NewReader(tt.body))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			switch tt.signature {
+			case "":
+				req.Header.Set("X-Hub-Signature-256", sign(testSecret, tt.body))
+			case "-":
+			default:
+				req.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			h.HandleGitHub(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(cache.invalidated, tt.wantInvalid) {
+				t.Errorf("invalidated %v, want %v", cache.invalidated, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestHandleGitHubMethodAndSize(t *testing.T) {
+	h := NewWebhookHandler(&fakeCache{}, testSecret, "")
+
+	rec := httptest.NewRecorder()
+	h.HandleGitHub(rec, httptest.NewRequest(http.MethodGet, "/v1/webhook/github", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	body := strings.Repeat(" ", maxWebhookPayload+1)
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhook/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", sign(testSecret, body))
+	rec = httptest.NewRecorder()
+	h.HandleGitHub(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized payload: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandleGitHubForwards(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   string
+	}
+	received := make(chan delivery, 1)
+	argocd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header, body: string(body)}
+	}))
+	defer argocd.Close()
+
+	h := NewWebhookHandler(&fakeCache{}, testSecret, argocd.URL+"/api/webhook")
+	body := pushPayload("refs/heads/main")
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhook/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-GitHub-Delivery", "42")
+	req.Header.Set("X-Hub-Signature-256", sign(testSecret, body))
+	req.Header.Set("Authorization", "Bearer not-forwarded")
+	h.HandleGitHub(httptest.NewRecorder(), req)
+
+	select {
+	case got := <-received:
+		if got.body != body {
+			t.Errorf("forwarded body = %q, want %q", got.body, body)
+		}
+		for _, name := range []string{"Content-Type", "X-GitHub-Event", "X-GitHub-Delivery", "X-Hub-Signature-256"} {
+			if got.header.Get(name) != req.Header.Get(name) {
+				t.Errorf("forwarded %s = %q, want %q", name, got.header.Get(name), req.Header.Get(name))
+			}
+		}
+		if got.header.Get("Authorization") != "" {
+			t.Error("Authorization header was forwarded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not forwarded")
+	}
+}
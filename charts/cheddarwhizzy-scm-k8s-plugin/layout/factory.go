@@ -10,9 +10,17 @@ import (
 func NewResolver(config *types.LayoutConfig) (Resolver, error) {
 	switch config.Strategy {
 	case types.LayoutMonorepo:
-		return NewMonorepoResolver(config), nil
+		resolver, err := NewMonorepoResolver(config)
+		if err != nil {
+			return nil, err
+		}
+		return resolver, nil
 	case types.LayoutSplitByEnv:
-		return NewSplitByEnvResolver(config), nil
+		resolver, err := NewSplitByEnvResolver(config)
+		if err != nil {
+			return nil, err
+		}
+		return resolver, nil
 	case types.LayoutBusinessApp:
 		return NewBusinessAppResolver(config), nil
 	default:
@@ -10,20 +10,26 @@ import (
 // MonorepoResolver resolves paths for kubernetes-manifests monorepo layout
 // Path format: <cluster>/infra|apps/<namespace>/<chart>
 type MonorepoResolver struct {
-	config *types.LayoutConfig
+	config   *types.LayoutConfig
+	template *PathTemplate // nil when indexes are used
 }
 
 // NewMonorepoResolver creates a new monorepo resolver
-func NewMonorepoResolver(config *types.LayoutConfig) *MonorepoResolver {
-	return &MonorepoResolver{
-		config: config,
+func NewMonorepoResolver(config *types.LayoutConfig) (*MonorepoResolver, error) {
+	template, err := compilePathStructure(config.PathStructure)
+	if err != nil {
+		return nil, err
 	}
+	return &MonorepoResolver{
+		config:   config,
+		template: template,
+	}, nil
 }
 
 // Resolve parses a monorepo path into structured components
 func (r *MonorepoResolver) Resolve(repoName, repoPath string) (*types.ResolvedLayout, error) {
 	pathParts := strings.Split(repoPath, "/")
-	if len(pathParts) < 4 {
+	if r.template == nil && len(pathParts) < 4 {
 		return nil, fmt.Errorf("monorepo path must have at least 4 segments, got %d: %s", len(pathParts), repoPath)
 	}
 
@@ -39,6 +45,14 @@ func (r *MonorepoResolver) Resolve(repoName, repoPath string) (*types.ResolvedLa
 		}
 	}
 
+	// Template placeholders override the cluster resolver
+	if r.template != nil {
+		if err := resolveTemplate(r.template, repoPath, resolved); err != nil {
+			return nil, err
+		}
+		return resolved, nil
+	}
+
 	// Type: infra or apps
 	if r.config.PathStructure.TypeIndex < len(pathParts) {
 		resolved.Type = pathParts[r.config.PathStructure.TypeIndex]
@@ -11,36 +11,160 @@ import (
 // SplitByEnvResolver resolves paths for kubernetes-<env>-<cluster> split repo layout
 // Path format: infra|apps/<namespace>/<chart>
 type SplitByEnvResolver struct {
-	config *types.LayoutConfig
+	config         *types.LayoutConfig
+	template       *PathTemplate  // nil when indexes are used
+	envPattern     *regexp.Regexp // EnvResolver.FromRepoPattern
+	clusterPattern *regexp.Regexp // ClusterResolver.FromRepoPattern
 }
 
-// NewSplitByEnvResolver creates a new split-by-env resolver
-func NewSplitByEnvResolver(config *types.LayoutConfig) *SplitByEnvResolver {
-	return &SplitByEnvResolver{
-		config: config,
+// NewSplitByEnvResolver creates a new split-by-env resolver.
+// Repo name patterns may use named groups (?P<env>...) and (?P<cluster>...);
+// without them group 1 is the env and group 2 the cluster.
+func NewSplitByEnvResolver(config *types.LayoutConfig) (*SplitByEnvResolver, error) {
+	template, err := compilePathStructure(config.PathStructure)
+	if err != nil {
+		return nil, err
 	}
+	r := &SplitByEnvResolver{
+		config:   config,
+		template: template,
+	}
+
+	if pattern := config.EnvResolver.FromRepoPattern; pattern != "" {
+		r.envPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid envResolver.fromRepoPattern: %w", err)
+		}
+		if hasNamedGroups(r.envPattern) {
+			if r.envPattern.SubexpIndex("env") < 0 && !(template != nil && template.Has("env")) {
+				return nil, fmt.Errorf("envResolver.fromRepoPattern %q has named groups but no (?P<env>...)", pattern)
+			}
+		} else if r.envPattern.NumSubexp() < 2 {
+			return nil, fmt.Errorf("envResolver.fromRepoPattern %q must capture env and cluster", pattern)
+		}
+	}
+
+	if pattern := config.ClusterResolver.FromRepoPattern; pattern != nil && *pattern != "" {
+		r.clusterPattern, err = regexp.Compile(*pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clusterResolver.fromRepoPattern: %w", err)
+		}
+		if hasNamedGroups(r.clusterPattern) && r.clusterPattern.SubexpIndex("cluster") < 0 {
+			return nil, fmt.Errorf("clusterResolver.fromRepoPattern %q has named groups but no (?P<cluster>...)", *pattern)
+		}
+		if r.clusterPattern.NumSubexp() < 1 {
+			return nil, fmt.Errorf("clusterResolver.fromRepoPattern %q must capture the cluster", *pattern)
+		}
+	}
+
+	hasTemplate := func(name string) bool {
+		return template != nil && template.Has(name)
+	}
+	if r.envPattern == nil && !hasTemplate("env") {
+		return nil, fmt.Errorf("split-by-env layout needs envResolver.fromRepoPattern or an {env} template placeholder")
+	}
+	envPatternHasCluster := r.envPattern != nil && (!hasNamedGroups(r.envPattern) || r.envPattern.SubexpIndex("cluster") >= 0)
+	if !envPatternHasCluster && r.clusterPattern == nil && !hasTemplate("cluster") {
+		return nil, fmt.Errorf("split-by-env layout needs a cluster from a (?P<cluster>...) group, clusterResolver.fromRepoPattern or a {cluster} template placeholder")
+	}
+
+	return r, nil
+}
+
+// hasNamedGroups reports whether a regex has any named capture group
+func hasNamedGroups(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRepoName applies a repo name pattern. Named groups are returned by
+// name; without named groups, the positional groups get the names in positional.
+func matchRepoName(re *regexp.Regexp, repoName string, positional ...string) (map[string]string, error) {
+	matches := re.FindStringSubmatch(repoName)
+	if matches == nil {
+		return nil, fmt.Errorf("repo name %s does not match pattern %s", repoName, re)
+	}
+
+	values := make(map[string]string)
+	if hasNamedGroups(re) {
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				values[name] = matches[i]
+			}
+		}
+		return values, nil
+	}
+	for i, name := range positional {
+		if name != "" && i+1 < len(matches) {
+			values[name] = matches[i+1]
+		}
+	}
+	return values, nil
 }
 
 // Resolve parses a split repo path and extracts env/cluster from repo name
 func (r *SplitByEnvResolver) Resolve(repoName, repoPath string) (*types.ResolvedLayout, error) {
 	pathParts := strings.Split(repoPath, "/")
-	if len(pathParts) < 3 {
+	if r.template == nil && len(pathParts) < 3 {
 		return nil, fmt.Errorf("split repo path must have at least 3 segments, got %d: %s", len(pathParts), repoPath)
 	}
 
 	resolved := &types.ResolvedLayout{}
+	values := make(map[string]string)
 
 	// Extract env and cluster from repo name using pattern
-	if r.config.EnvResolver.FromRepoPattern != "" {
-		pattern := regexp.MustCompile(r.config.EnvResolver.FromRepoPattern)
-		matches := pattern.FindStringSubmatch(repoName)
-		if len(matches) >= 3 {
-			// matches[0] is full match, matches[1] is env, matches[2] is cluster
-			resolved.Env = matches[1]
-			resolved.Cluster = matches[2]
-		} else {
-			return nil, fmt.Errorf("failed to extract env/cluster from repo name %s using pattern %s", repoName, r.config.EnvResolver.FromRepoPattern)
+	if r.envPattern != nil {
+		envValues, err := matchRepoName(r.envPattern, repoName, "env", "cluster")
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract env/cluster: %w", err)
+		}
+		for name, value := range envValues {
+			values[name] = value
+		}
+	}
+
+	// A cluster pattern takes precedence over the cluster of the env pattern.
+	// Unnamed, it captures the cluster in group 2 (same shape as the env
+	// pattern) or, with a single group, in group 1.
+	if r.clusterPattern != nil {
+		positional := []string{"cluster"}
+		if r.clusterPattern.NumSubexp() >= 2 {
+			positional = []string{"", "cluster"}
+		}
+		clusterValues, err := matchRepoName(r.clusterPattern, repoName, positional...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract cluster: %w", err)
+		}
+		for name, value := range clusterValues {
+			values[name] = value
+		}
+	}
+
+	for name, value := range values {
+		switch name {
+		case "env":
+			resolved.Env = value
+		case "cluster":
+			resolved.Cluster = value
+		default:
+			// Extra named groups, e.g. (?P<region>...)
+			if resolved.Captures == nil {
+				resolved.Captures = make(map[string]string)
+			}
+			resolved.Captures[name] = value
+		}
+	}
+
+	// Template placeholders override env/cluster from the repo name
+	if r.template != nil {
+		if err := resolveTemplate(r.template, repoPath, resolved); err != nil {
+			return nil, err
 		}
+		return resolved, nil
 	}
 
 	// Type: infra or apps (first path segment)
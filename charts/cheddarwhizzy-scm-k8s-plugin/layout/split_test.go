@@ -0,0 +1,64 @@
+package layout_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/layout"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+func TestSplitByEnvResolver(t *testing.T) {
+	regionPattern := "^kubernetes-(?P<env>[^-]+)-(?P<cluster>(?P<region>[a-z]+-[a-z]+)-[0-9]+)$"
+	custom := config.DefaultSplitByEnvLayout()
+	custom.EnvResolver.FromRepoPattern = regionPattern
+	custom.ClusterResolver.FromRepoPattern = nil
+
+	positional := config.DefaultSplitByEnvLayout()
+	positional.EnvResolver.FromRepoPattern = "kubernetes-(.+)-(.+)"
+	positional.ClusterResolver.FromRepoPattern = nil
+
+	tests := []struct {
+		name     string
+		layout   *types.LayoutConfig
+		repo     string
+		env      string
+		cluster  string
+		captures map[string]string
+	}{
+		{"default", config.DefaultSplitByEnvLayout(), "kubernetes-prod-cluster1", "prod", "cluster1", nil},
+		{"default multi-dash cluster", config.DefaultSplitByEnvLayout(), "kubernetes-prod-us-east-1", "prod", "us-east-1", nil},
+		{"extra named groups", custom, "kubernetes-prod-us-east-1", "prod", "us-east-1", map[string]string{"region": "us-east"}},
+		{"positional groups", positional, "kubernetes-qa-cluster2", "qa", "cluster2", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := layout.NewResolver(tt.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := resolver.Resolve(tt.repo, "infra/cnpg/cloudnative-pg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved.Env != tt.env || resolved.Cluster != tt.cluster {
+				t.Errorf("got env %q cluster %q, want %q %q", resolved.Env, resolved.Cluster, tt.env, tt.cluster)
+			}
+			if !reflect.DeepEqual(resolved.Captures, tt.captures) {
+				t.Errorf("captures = %v, want %v", resolved.Captures, tt.captures)
+			}
+			if resolved.Type != "infra" || resolved.Namespace != "cnpg" || resolved.Chart != "cloudnative-pg" {
+				t.Errorf("got %s/%s/%s, want infra/cnpg/cloudnative-pg", resolved.Type, resolved.Namespace, resolved.Chart)
+			}
+		})
+	}
+
+	resolver, err := layout.NewResolver(config.DefaultSplitByEnvLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve("kubernetes-manifests", "infra/cnpg/cloudnative-pg"); err == nil {
+		t.Error("repo name without a cluster: expected an error")
+	}
+}
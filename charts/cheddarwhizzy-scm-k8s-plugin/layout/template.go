@@ -0,0 +1,179 @@
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// placeholderPattern matches {name} placeholders in a path template
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// placeholderName is the allowed syntax of a placeholder name
+var placeholderName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PathTemplate matches repository paths against a template such as
+// "clusters/{cluster}/namespaces/{namespace}/{chart}".
+// A {name} placeholder matches (part of) one path segment, other text is
+// literal and a "**" segment matches any number of segments.
+type PathTemplate struct {
+	raw   string
+	re    *regexp.Regexp
+	names map[string]bool
+}
+
+// CompilePathTemplate compiles a path template
+func CompilePathTemplate(template string) (*PathTemplate, error) {
+	template = strings.Trim(template, "/")
+	if template == "" {
+		return nil, fmt.Errorf("path template is empty")
+	}
+
+	segments := strings.Split(template, "/")
+	names := make(map[string]bool)
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	needSeparator := false
+	for i, segment := range segments {
+		if segment == "**" {
+			switch {
+			case len(segments) == 1:
+				pattern.WriteString(".*")
+			case i == len(segments)-1:
+				pattern.WriteString("(?:/[^/]+)*")
+			default:
+				// Consumes its own separator so "a/**/b" also matches "a/b"
+				if needSeparator {
+					pattern.WriteString("/")
+				}
+				pattern.WriteString("(?:[^/]+/)*")
+				needSeparator = false
+			}
+			continue
+		}
+		if segment == "" {
+			return nil, fmt.Errorf("path template %q has an empty segment", template)
+		}
+		if strings.Contains(segment, "**") {
+			return nil, fmt.Errorf("path template %q: ** must be a whole segment", template)
+		}
+
+		if needSeparator {
+			pattern.WriteString("/")
+		}
+		literalStart := 0
+		for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(segment, -1) {
+			name := segment[loc[2]:loc[3]]
+			if !placeholderName.MatchString(name) {
+				return nil, fmt.Errorf("path template %q: invalid placeholder {%s}", template, name)
+			}
+			if names[name] {
+				return nil, fmt.Errorf("path template %q: placeholder {%s} is used twice", template, name)
+			}
+			names[name] = true
+			if err := writeLiteral(&pattern, template, segment[literalStart:loc[0]]); err != nil {
+				return nil, err
+			}
+			pattern.WriteString(fmt.Sprintf("(?P<%s>[^/]+?)", name))
+			literalStart = loc[1]
+		}
+		if err := writeLiteral(&pattern, template, segment[literalStart:]); err != nil {
+			return nil, err
+		}
+		needSeparator = true
+	}
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("path template %q: %w", template, err)
+	}
+	return &PathTemplate{raw: template, re: re, names: names}, nil
+}
+
+// writeLiteral appends literal template text, rejecting stray braces
+func writeLiteral(pattern *strings.Builder, template, literal string) error {
+	if strings.ContainsAny(literal, "{}") {
+		return fmt.Errorf("path template %q: unbalanced braces", template)
+	}
+	pattern.WriteString(regexp.QuoteMeta(literal))
+	return nil
+}
+
+// Has reports whether the template captures a placeholder
+func (t *PathTemplate) Has(name string) bool {
+	return t.names[name]
+}
+
+// Match returns the placeholder values of a path, or false if it does not match
+func (t *PathTemplate) Match(repoPath string) (map[string]string, bool) {
+	matches := t.re.FindStringSubmatch(strings.Trim(repoPath, "/"))
+	if matches == nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(t.names))
+	for i, name := range t.re.SubexpNames() {
+		if name != "" {
+			values[name] = matches[i]
+		}
+	}
+	return values, true
+}
+
+// String returns the template source
+func (t *PathTemplate) String() string {
+	return t.raw
+}
+
+// compilePathStructure compiles the template of a path structure, if any.
+// A template must capture the chart.
+func compilePathStructure(structure types.PathStructure) (*PathTemplate, error) {
+	if structure.Template == "" {
+		return nil, nil
+	}
+	template, err := CompilePathTemplate(structure.Template)
+	if err != nil {
+		return nil, err
+	}
+	if !template.Has("chart") {
+		return nil, fmt.Errorf("path template %q must contain {chart}", structure.Template)
+	}
+	return template, nil
+}
+
+// resolveTemplate fills resolved from the placeholders of a matching path.
+// cluster, env, type, namespace and chart set the fields of the same name;
+// any other placeholder is exposed in Captures.
+func resolveTemplate(template *PathTemplate, repoPath string, resolved *types.ResolvedLayout) error {
+	values, ok := template.Match(repoPath)
+	if !ok {
+		return fmt.Errorf("path %s does not match template %s", repoPath, template)
+	}
+
+	for name, value := range values {
+		switch name {
+		case "cluster":
+			resolved.Cluster = value
+		case "env":
+			resolved.Env = value
+		case "type":
+			resolved.Type = value
+		case "namespace":
+			resolved.Namespace = value
+		case "chart":
+			resolved.Chart = value
+		default:
+			if resolved.Captures == nil {
+				resolved.Captures = make(map[string]string)
+			}
+			resolved.Captures[name] = value
+		}
+	}
+	if resolved.Namespace == "" {
+		resolved.Namespace = "default"
+	}
+	return nil
+}
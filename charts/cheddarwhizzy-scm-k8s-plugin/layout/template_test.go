@@ -0,0 +1,131 @@
+package layout
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+func TestCompilePathTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		regex    string
+		names    []string
+	}{
+		{"{chart}", `^(?P<chart>[^/]+?)$`, []string{"chart"}},
+		{"/clusters/{cluster}/{chart}/", `^clusters/(?P<cluster>[^/]+?)/(?P<chart>[^/]+?)$`, []string{"cluster", "chart"}},
+		{"apps/{env}-{cluster}.d/{chart}", `^apps/(?P<env>[^/]+?)-(?P<cluster>[^/]+?)\.d/(?P<chart>[^/]+?)$`, []string{"env", "cluster", "chart"}},
+		{"**", `^.*$`, nil},
+		{"**/{chart}", `^(?:[^/]+/)*(?P<chart>[^/]+?)$`, []string{"chart"}},
+		{"apps/**/{chart}", `^apps/(?:[^/]+/)*(?P<chart>[^/]+?)$`, []string{"chart"}},
+		{"apps/{chart}/**", `^apps/(?P<chart>[^/]+?)(?:/[^/]+)*$`, []string{"chart"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			compiled, err := CompilePathTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := compiled.re.String(); got != tt.regex {
+				t.Errorf("regex = %s, want %s", got, tt.regex)
+			}
+			if len(compiled.names) != len(tt.names) {
+				t.Errorf("names = %v, want %v", compiled.names, tt.names)
+			}
+			for _, name := range tt.names {
+				if !compiled.Has(name) {
+					t.Errorf("template does not capture %s", name)
+				}
+			}
+			if compiled.String() != strings.Trim(tt.template, "/") {
+				t.Errorf("String() = %q", compiled.String())
+			}
+		})
+	}
+}
+
+func TestCompilePathTemplateErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"", "empty"},
+		{"/", "empty"},
+		{"apps//{chart}", "empty segment"},
+		{"apps/a**/{chart}", "whole segment"},
+		{"apps/{}", "invalid placeholder"},
+		{"apps/{1chart}", "invalid placeholder"},
+		{"apps/{chart-name}", "invalid placeholder"},
+		{"{chart}/{chart}", "used twice"},
+		{"{env}/{env}-{chart}", "used twice"},
+		{"apps/{chart", "unbalanced braces"},
+		{"apps/chart}", "unbalanced braces"},
+		{"apps/{{chart}}", "unbalanced braces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			_, err := CompilePathTemplate(tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPathTemplateMatch(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		want     map[string]string
+	}{
+		{"clusters/{cluster}/{chart}", "clusters/prod-east/nginx", map[string]string{"cluster": "prod-east", "chart": "nginx"}},
+		{"clusters/{cluster}/{chart}", "/clusters/prod-east/nginx/", map[string]string{"cluster": "prod-east", "chart": "nginx"}},
+		{"clusters/{cluster}/{chart}", "clusters/prod-east/infra/nginx", nil},
+		{"clusters/{cluster}/{chart}", "clusters/prod-east", nil},
+		// Placeholders are lazy, so the literal splits at its first occurrence
+		{"{env}-{cluster}/{chart}", "prod-eu-west/nginx", map[string]string{"env": "prod", "cluster": "eu-west", "chart": "nginx"}},
+		{"apps/**/{chart}", "apps/nginx", map[string]string{"chart": "nginx"}},
+		{"apps/**/{chart}", "apps/a/b/c/nginx", map[string]string{"chart": "nginx"}},
+		{"apps/**/{chart}", "other/nginx", nil},
+		{"apps/{chart}/**", "apps/nginx", map[string]string{"chart": "nginx"}},
+		{"apps/{chart}/**", "apps/nginx/templates/deploy", map[string]string{"chart": "nginx"}},
+		{"**", "anything/at/all", map[string]string{}},
+	}
+	for _, tt := range tests {
+		compiled, err := CompilePathTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := compiled.Match(tt.path)
+		if ok != (tt.want != nil) || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s matching %s = %v (%v), want %v", tt.template, tt.path, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCompilePathStructure(t *testing.T) {
+	if template, err := compilePathStructure(types.PathStructure{}); template != nil || err != nil {
+		t.Errorf("no template: got %v, %v", template, err)
+	}
+	if _, err := compilePathStructure(types.PathStructure{Template: "clusters/{cluster}"}); err == nil {
+		t.Error("expected an error for a template without {chart}")
+	}
+
+	template, err := compilePathStructure(types.PathStructure{Template: "{cluster}/{team}/{chart}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resolved types.ResolvedLayout
+	if err := resolveTemplate(template, "c1/payments/api", &resolved); err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Cluster != "c1" || resolved.Chart != "api" || resolved.Namespace != "default" ||
+		resolved.Captures["team"] != "payments" {
+		t.Errorf("resolved = %+v", resolved)
+	}
+	if err := resolveTemplate(template, "c1/api", &resolved); err == nil {
+		t.Error("expected an error for a path not matching the template")
+	}
+}
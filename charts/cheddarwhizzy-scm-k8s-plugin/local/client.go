@@ -0,0 +1,394 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Client serves repositories from clones or bare repositories on disk laid out
+// as <root>/<org>/<repo>.git (bare) or <root>/<org>/<repo> (working copy)
+type Client struct {
+	root      string
+	urlPrefix string
+
+	mu    sync.Mutex
+	trees map[string]commitTree // latest tree listed per repo dir
+}
+
+// Client implements scm.Provider
+var _ scm.Provider = (*Client)(nil)
+
+// NewClient creates a client for repositories under root.
+// urlPrefix is prepended to "<org>/<repo>.git" when building repo URLs,
+// e.g. the URL of the git mirror ArgoCD clones from; it defaults to file://<root>/.
+func NewClient(root, urlPrefix string) (*Client, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository root: %w", err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("repository root %s is not a directory", root)
+	}
+	if urlPrefix == "" {
+		urlPrefix = "file://" + filepath.ToSlash(root)
+	}
+	if !strings.HasSuffix(urlPrefix, "/") && !strings.HasSuffix(urlPrefix, ":") {
+		urlPrefix += "/"
+	}
+	return &Client{
+		root:      root,
+		urlPrefix: urlPrefix,
+		trees:     make(map[string]commitTree),
+	}, nil
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return "local"
+}
+
+// RepoURL builds the clone URL for a repository
+func (c *Client) RepoURL(owner, repo string) string {
+	return fmt.Sprintf("%s%s/%s.git", c.urlPrefix, owner, repo)
+}
+
+// ParseRepoURL extracts owner and repo name from a URL built by RepoURL
+func (c *Client) ParseRepoURL(url string) (string, string, error) {
+	if !strings.HasPrefix(url, c.urlPrefix) {
+		return "", "", fmt.Errorf("unsupported URL format: %s", url)
+	}
+	parts := strings.TrimSuffix(strings.TrimPrefix(url, c.urlPrefix), ".git")
+	split := strings.Split(parts, "/")
+	if len(split) != 2 || !validName(split[0]) || !validName(split[1]) {
+		return "", "", fmt.Errorf("invalid local repository URL format: %s", url)
+	}
+	return split[0], split[1], nil
+}
+
+// validName reports whether an org or repository name is a single path
+// segment, so names from requests cannot address files outside the root
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// path joins names to the root, rejecting names that would leave it
+func (c *Client) path(names ...string) (string, error) {
+	for _, name := range names {
+		if !validName(name) {
+			return "", fmt.Errorf("invalid repository path %q", strings.Join(names, "/"))
+		}
+	}
+	path := filepath.Join(append([]string{c.root}, names...)...)
+	if rel, err := filepath.Rel(c.root, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("repository path %q is outside the root", strings.Join(names, "/"))
+	}
+	return path, nil
+}
+
+// ReadProjectInfo reads project-info.yaml from a repository
+func (c *Client) ReadProjectInfo(ctx context.Context, owner, repo, branch string) (*types.ProjectInfo, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, "project-info.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project-info.yaml: %w", err)
+	}
+
+	var projectInfo types.ProjectInfo
+	if err := yaml.Unmarshal(content, &projectInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse project-info.yaml: %w", err)
+	}
+
+	return &projectInfo, nil
+}
+
+// ReadArgoCDConfig reads argocd-config.yaml from a chart directory
+func (c *Client) ReadArgoCDConfig(ctx context.Context, owner, repo, branch, chartPath string) (*types.ArgoCDConfig, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, fmt.Sprintf("%s/argocd-config.yaml", chartPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get argocd-config.yaml: %w", err)
+	}
+
+	var argocdConfig types.ArgoCDConfig
+	if err := yaml.Unmarshal(content, &argocdConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse argocd-config.yaml: %w", err)
+	}
+
+	return &argocdConfig, nil
+}
+
+// ReadFile returns the content of a file
+func (c *Client) ReadFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error) {
+	content, err := c.readFile(ctx, owner, repo, branch, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// DiscoverCharts discovers chart directories in a given path
+func (c *Client) DiscoverCharts(ctx context.Context, owner, repo, branch, envPath string) ([]string, error) {
+	tree, _, err := c.tree(ctx, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if !tree.IsDir(envPath) {
+		return nil, fmt.Errorf("failed to get contents of %s: %w", envPath, scm.ErrNotFound)
+	}
+
+	var charts []string
+	for _, chartName := range tree.ListDirs(envPath) {
+		// Check if it's a valid chart (has values.yaml or a kustomization - indicates env-specific override exists)
+		if !strings.HasPrefix(chartName, ".") && scm.IsChartDir(tree.ListFiles(envPath+"/"+chartName)) {
+			charts = append(charts, chartName)
+		}
+	}
+	return charts, nil
+}
+
+// ListChartFiles lists all files in a chart directory and returns a map of filename -> exists
+func (c *Client) ListChartFiles(ctx context.Context, owner, repo, branch, chartDirPath string) (map[string]bool, error) {
+	tree, _, err := c.tree(ctx, owner, repo, branch)
+	if err != nil {
+		if scm.IsNotFound(err) {
+			return make(map[string]bool), nil
+		}
+		return make(map[string]bool), err
+	}
+	return tree.ListFiles(chartDirPath), nil
+}
+
+// HasPath checks if a path exists in a repository
+func (c *Client) HasPath(ctx context.Context, owner, repo, branch, path string) (bool, error) {
+	tree, _, err := c.tree(ctx, owner, repo, branch)
+	if err != nil {
+		if scm.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return tree.HasPath(path), nil
+}
+
+// DiscoverRepos discovers repositories in an org directory that pass filter and have deployment/k8s/<env> paths.
+// Local repositories have no topics, are private, never archived or forks, and
+// were last pushed when the default branch was last committed to.
+func (c *Client) DiscoverRepos(ctx context.Context, org string, envs []string, defaultBranch string, filter scm.RepoFilter) ([]scm.Repository, error) {
+	log.Printf("Discovering local repos for org: %s, envs: %v", org, envs)
+
+	orgDir, err := c.path(org)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(orgDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("org directory %s: %w", org, scm.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to list repos for org %s: %w", org, err)
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names[strings.TrimSuffix(entry.Name(), ".git")] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var allRepos []scm.Repository
+	var errs []error
+	for _, repoName := range sorted {
+		if !filter.MatchesName(org, repoName) {
+			log.Printf("Skipping repo %s/%s: excluded by repository patterns", org, repoName)
+			continue
+		}
+		tree, _, err := c.tree(ctx, org, repoName, defaultBranch)
+		if err != nil {
+			// Directories that are not git repositories or lack the branch are skipped
+			if !scm.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		meta := scm.RepoMetadata{Visibility: "private"}
+		if filter.NeedsPushedAt() {
+			meta.PushedAt, err = c.commitTime(ctx, org, repoName, defaultBranch)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if !filter.Matches(meta) {
+			log.Printf("Skipping repo %s/%s: excluded by repository filter", org, repoName)
+			continue
+		}
+
+		for _, env := range envs {
+			if tree.HasPath(fmt.Sprintf("deployment/k8s/%s", env)) {
+				log.Printf("  Adding repo: %s/%s", org, repoName)
+				allRepos = append(allRepos, scm.Repository{
+					Owner: org,
+					Name:  repoName,
+					URL:   c.RepoURL(org, repoName),
+				})
+				break
+			}
+		}
+	}
+
+	log.Printf("Total repos found for org %s: %d", org, len(allRepos))
+	return allRepos, errors.Join(errs...)
+}
+
+// commitTime returns the committer date of the commit the branch points to
+func (c *Client) commitTime(ctx context.Context, owner, repo, branch string) (time.Time, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sha, err := c.resolveRef(ctx, dir, branch)
+	if err != nil {
+		return time.Time{}, err
+	}
+	out, err := c.git(ctx, dir, "log", "-1", "--format=%ct", sha)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse commit time of %s/%s: %w", owner, repo, err)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// readFile returns the content of a file at the given branch
+func (c *Client) readFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error) {
+	tree, sha, err := c.tree(ctx, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if !tree.HasPath(path) || tree.IsDir(path) {
+		return nil, fmt.Errorf("%s: %w", path, scm.ErrNotFound)
+	}
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.git(ctx, dir, "show", sha+":"+path)
+}
+
+// tree returns the file tree of the commit the branch points to
+func (c *Client) tree(ctx context.Context, owner, repo, branch string) (*scm.Tree, string, error) {
+	dir, err := c.repoDir(owner, repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sha, err := c.resolveRef(ctx, dir, branch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c.mu.Lock()
+	cached, exists := c.trees[dir]
+	c.mu.Unlock()
+	if exists && cached.sha == sha {
+		return cached.tree, sha, nil
+	}
+
+	out, err := c.git(ctx, dir, "ls-tree", "-r", "-z", "--full-tree", "--name-only", sha)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list files of %s/%s: %w", owner, repo, err)
+	}
+	var files []string
+	for _, file := range bytes.Split(out, []byte{0}) {
+		if len(file) > 0 {
+			files = append(files, string(file))
+		}
+	}
+	tree := scm.NewTree(files)
+
+	// Commits are immutable, so a tree is valid until the repo moves on;
+	// only the latest is kept so new commits do not grow the cache
+	c.mu.Lock()
+	c.trees[dir] = commitTree{sha: sha, tree: tree}
+	c.mu.Unlock()
+
+	return tree, sha, nil
+}
+
+// commitTree is the file tree of a commit
+type commitTree struct {
+	sha  string
+	tree *scm.Tree
+}
+
+// resolveRef resolves a branch name (local or remote-tracking), tag or SHA to a commit SHA
+func (c *Client) resolveRef(ctx context.Context, dir, ref string) (string, error) {
+	// git would read a leading dash as an option
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref %q", ref)
+	}
+	candidates := []string{"refs/heads/" + ref, "refs/remotes/origin/" + ref, ref}
+	for _, candidate := range candidates {
+		out, err := c.git(ctx, dir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", fmt.Errorf("ref %s in %s: %w", ref, dir, scm.ErrNotFound)
+}
+
+// repoDir returns the on-disk directory of a repository
+func (c *Client) repoDir(owner, repo string) (string, error) {
+	for _, name := range []string{repo + ".git", repo} {
+		candidate, err := c.path(owner, name)
+		if err != nil {
+			return "", err
+		}
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("repository %s/%s: %w", owner, repo, scm.ErrNotFound)
+}
+
+// git runs a git command in dir and returns its stdout
+func (c *Client) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	// Never fall back to a repository enclosing the root directory
+	cmd.Env = append(os.Environ(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(dir))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package local
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// commit writes a file to the repository at dir and commits it on main
+func commit(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", name},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+}
+
+func TestTreeCacheKeepsLatestCommit(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "acme", "shop")
+	commit(t, dir, "a.yaml")
+
+	c, err := NewClient(root, "https://git.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i, name := range []string{"b.yaml", "c.yaml"} {
+		commit(t, dir, name)
+		exists, err := c.HasPath(ctx, "acme", "shop", "main", name)
+		if err != nil || !exists {
+			t.Fatalf("commit %d: HasPath(%s) = %v, %v", i, name, exists, err)
+		}
+		if len(c.trees) != 1 {
+			t.Errorf("commit %d: cached %d trees, want only the latest", i, len(c.trees))
+		}
+	}
+}
@@ -1,37 +1,186 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/cluster"
+	layoutconfig "github.com/cheddarwhizzy/argocd-scm-k8s-plugin/config"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/generator"
 	ghclient "github.com/cheddarwhizzy/argocd-scm-k8s-plugin/github"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/gitlab"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/handler"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/local"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/metrics"
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/scm"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
 	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/utils"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func main() {
 	// Load configuration from environment
 	config := &types.Config{
-		GitHubToken:   os.Getenv("GITHUB_TOKEN"),
-		DefaultBranch: utils.GetEnvOrDefault("DEFAULT_BRANCH", "main"),
+		GitHubToken:     os.Getenv("GITHUB_TOKEN"),
+		GitLabToken:     os.Getenv("GITLAB_TOKEN"),
+		GitLabURL:       utils.GetEnvOrDefault("GITLAB_URL", "https://gitlab.com"),
+		LocalReposRoot:  os.Getenv("LOCAL_REPOS_ROOT"),
+		LocalRepoURL:    os.Getenv("LOCAL_REPO_URL_PREFIX"),
+		DefaultProvider: os.Getenv("DEFAULT_SCM_PROVIDER"),
+		DefaultBranch:   utils.GetEnvOrDefault("DEFAULT_BRANCH", "main"),
 		DefaultClusters: []types.ClusterConfig{
 			{Name: "in-cluster", DestinationName: "in-cluster"},
 		},
+		StrictMode:         utils.GetEnvBoolOrDefault("STRICT_MODE", false),
+		MaxDeletionPercent: utils.GetEnvFloatOrDefault("MAX_DELETION_PERCENT", 0),
+		MaxDeletionCount:   utils.GetEnvIntOrDefault("MAX_DELETION_COUNT", 0),
+		Parallelism:        utils.GetEnvIntOrDefault("DISCOVERY_PARALLELISM", 8),
+
+		MinDeletionBaseline: utils.GetEnvIntOrDefault("MIN_DELETION_BASELINE", 10),
+		DeletionAcceptAfter: utils.GetEnvDurationOrDefault("DELETION_ACCEPT_AFTER", 0),
+	}
+
+	// Layout rules are validated up front so a broken ConfigMap fails the rollout
+	if layoutFile := os.Getenv("LAYOUT_CONFIG_FILE"); layoutFile != "" {
+		rules, err := layoutconfig.LoadLayoutRules(layoutFile)
+		if err != nil {
+			log.Fatalf("Invalid layout configuration: %v", err)
+		}
+		log.Printf("Loaded %d layout rules from %s", len(rules), layoutFile)
+		config.LayoutRules = rules
+	}
+
+	// Clusters resolved from repository paths must be registered when a registry is set
+	if clusterFile := os.Getenv("CLUSTER_REGISTRY_FILE"); clusterFile != "" {
+		registry, err := cluster.LoadRegistry(clusterFile)
+		if err != nil {
+			log.Fatalf("Invalid cluster registry: %v", err)
+		}
+		log.Printf("Loaded clusters %v from %s", registry.Names(), clusterFile)
+		config.Clusters = registry
+	}
+	// Or the cluster inventory is read from ArgoCD's cluster secrets and kept in sync
+	if secretsNamespace := os.Getenv("CLUSTER_SECRETS_NAMESPACE"); secretsNamespace != "" {
+		if config.Clusters != nil {
+			log.Fatal("CLUSTER_REGISTRY_FILE and CLUSTER_SECRETS_NAMESPACE are mutually exclusive")
+		}
+		source, err := cluster.NewInClusterSecretSource(secretsNamespace, utils.GetEnvOrDefault("CLUSTER_ENV_LABEL", "env"))
+		if err != nil {
+			log.Fatalf("Failed to create cluster secret source: %v", err)
+		}
+		registry, err := cluster.NewRegistry([]cluster.Cluster{cluster.InCluster})
+		if err != nil {
+			log.Fatalf("Failed to create cluster registry: %v", err)
+		}
+		if err := registry.Sync(context.Background(), source); errors.Is(err, cluster.ErrNoClusters) {
+			log.Printf("Warning: no cluster secrets in %s, only in-cluster is registered", secretsNamespace)
+		} else if err != nil {
+			log.Fatalf("Failed to read cluster secrets: %v", err)
+		}
+		log.Printf("Loaded clusters %v from cluster secrets in %s", registry.Names(), secretsNamespace)
+		go registry.Poll(context.Background(), source, utils.GetEnvDurationOrDefault("CLUSTER_REFRESH_INTERVAL", time.Minute))
+		config.Clusters = registry
+	}
+	if value := os.Getenv("DEFAULT_CLUSTER_SELECTOR"); value != "" {
+		if config.Clusters == nil {
+			log.Fatal("DEFAULT_CLUSTER_SELECTOR requires CLUSTER_REGISTRY_FILE or CLUSTER_SECRETS_NAMESPACE")
+		}
+		selector, err := labels.Parse(value)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_CLUSTER_SELECTOR: %v", err)
+		}
+		config.DefaultClusterSelector = selector
 	}
 
-	if config.GitHubToken == "" {
-		log.Fatal("GITHUB_TOKEN environment variable is required")
+	githubApp, err := loadGitHubAppConfig()
+	if err != nil {
+		log.Fatalf("Invalid GitHub App configuration: %v", err)
 	}
-	log.Printf("GitHub token loaded (length: %d)", len(config.GitHubToken))
 
-	// Create GitHub client
-	githubClient := ghclient.NewClient(config.GitHubToken)
+	if config.GitHubToken == "" && githubApp == nil && config.GitLabToken == "" && config.LocalReposRoot == "" {
+		log.Fatal("GITHUB_TOKEN, GITHUB_APP_ID, GITLAB_TOKEN or LOCAL_REPOS_ROOT environment variable is required")
+	}
+	log.Printf("Strict mode: %v", config.StrictMode)
+	log.Printf("Deletion guard: max %.1f%% (from %d applications), max %d applications, accept after %s",
+		config.MaxDeletionPercent, config.MinDeletionBaseline, config.MaxDeletionCount, config.DeletionAcceptAfter)
+	log.Printf("Discovery parallelism: %d", config.Parallelism)
+
+	// Create SCM providers
+	var providers []scm.Provider
+	githubOpts := []ghclient.Option{
+		ghclient.WithTreeTTL(utils.GetEnvDurationOrDefault("TREE_CACHE_TTL", 30*time.Second)),
+		ghclient.WithResponseCache(
+			utils.GetEnvDurationOrDefault("GITHUB_CACHE_TTL", time.Minute),
+			utils.GetEnvIntOrDefault("GITHUB_CACHE_MAX_ENTRIES", 10000),
+			utils.GetEnvIntOrDefault("GITHUB_CACHE_MAX_MB", 128)<<20,
+		),
+		ghclient.WithRateLimitReserve(utils.GetEnvIntOrDefault("GITHUB_RATE_LIMIT_RESERVE", 200)),
+	}
+	if baseURL := os.Getenv("GITHUB_BASE_URL"); baseURL != "" {
+		log.Printf("Using GitHub Enterprise Server API at %s", baseURL)
+		githubOpts = append(githubOpts, ghclient.WithEnterpriseURLs(baseURL, os.Getenv("GITHUB_UPLOAD_URL")))
+	}
+	if host := os.Getenv("GITHUB_HOST"); host != "" {
+		githubOpts = append(githubOpts, ghclient.WithHost(host))
+	}
+	if githubApp != nil {
+		githubClient, err := ghclient.NewAppClient(*githubApp, githubOpts...)
+		if err != nil {
+			log.Fatalf("Failed to create GitHub App client: %v", err)
+		}
+		log.Printf("Authenticating to GitHub as app %d (installation: %d, 0 = per org)", githubApp.AppID, githubApp.InstallationID)
+		providers = append(providers, githubClient)
+	} else if config.GitHubToken != "" {
+		log.Printf("GitHub token loaded (length: %d)", len(config.GitHubToken))
+		githubClient, err := ghclient.NewClient(config.GitHubToken, githubOpts...)
+		if err != nil {
+			log.Fatalf("Failed to create GitHub client: %v", err)
+		}
+		providers = append(providers, githubClient)
+	}
+	if config.GitLabToken != "" {
+		gitlabClient, err := gitlab.NewClient(config.GitLabURL, config.GitLabToken,
+			gitlab.WithRateLimitReserve(utils.GetEnvIntOrDefault("GITLAB_RATE_LIMIT_RESERVE", 100)))
+		if err != nil {
+			log.Fatalf("Failed to create GitLab client: %v", err)
+		}
+		log.Printf("GitLab token loaded for %s (length: %d)", config.GitLabURL, len(config.GitLabToken))
+		providers = append(providers, gitlabClient)
+	}
+	if config.LocalReposRoot != "" {
+		localClient, err := local.NewClient(config.LocalReposRoot, config.LocalRepoURL)
+		if err != nil {
+			log.Fatalf("Failed to create local git client: %v", err)
+		}
+		log.Printf("Serving local repositories from %s", config.LocalReposRoot)
+		providers = append(providers, localClient)
+	}
+
+	// Requests without a provider use the only configured one, or github
+	var providerNames []string
+	for _, provider := range providers {
+		providerNames = append(providerNames, provider.Name())
+	}
+	if config.DefaultProvider == "" {
+		config.DefaultProvider = "github"
+		if len(providers) == 1 {
+			config.DefaultProvider = providerNames[0]
+		}
+	}
+	if !slices.Contains(providerNames, config.DefaultProvider) {
+		log.Fatalf("Default SCM provider %q is not configured (configured: %v); set DEFAULT_SCM_PROVIDER", config.DefaultProvider, providerNames)
+	}
+	log.Printf("Default SCM provider: %s", config.DefaultProvider)
 
 	// Create generator
-	gen := generator.NewGenerator(config, githubClient)
+	gen := generator.NewGenerator(config, providers...)
 
 	// Create handler
 	h := handler.NewHandler(gen)
@@ -39,10 +188,20 @@ func main() {
 	// Health check endpoint
 	http.HandleFunc("/healthz", h.HandleHealthz)
 
+	// Prometheus metrics
+	http.HandleFunc("/metrics", metrics.Handler)
+
 	// Plugin endpoints - ArgoCD may use different paths depending on version
 	// Handle all known endpoint formats for compatibility
 	http.HandleFunc("/v1/generator.getParams", h.HandleGenerate)
 	http.HandleFunc("/api/v1/getparams.execute", h.HandleGenerate)
+
+	// GitHub push webhooks invalidate cached data for the pushed repo/branch
+	if webhookSecret := os.Getenv("GITHUB_WEBHOOK_SECRET"); webhookSecret != "" {
+		wh := handler.NewWebhookHandler(gen, webhookSecret, os.Getenv("ARGOCD_WEBHOOK_URL"))
+		http.HandleFunc("/v1/webhook/github", wh.HandleGitHub)
+		log.Printf("GitHub webhook receiver enabled on /v1/webhook/github")
+	}
 	http.HandleFunc("/generate", h.HandleGenerate) // Legacy endpoint for direct testing
 	// Catch-all handler to log what path ArgoCD is actually calling
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -59,3 +218,40 @@ func main() {
 	log.Printf("Starting plugin server on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
+
+// loadGitHubAppConfig reads GitHub App settings from the environment.
+// It returns nil when GITHUB_APP_ID is not set.
+func loadGitHubAppConfig() (*ghclient.AppConfig, error) {
+	appIDValue := os.Getenv("GITHUB_APP_ID")
+	if appIDValue == "" {
+		return nil, nil
+	}
+
+	appID, err := strconv.ParseInt(appIDValue, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("GITHUB_APP_ID must be a number: %w", err)
+	}
+
+	keyFile := os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE")
+	if keyFile == "" {
+		return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY_FILE is required with GITHUB_APP_ID")
+	}
+	privateKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+
+	var installationID int64
+	if value := os.Getenv("GITHUB_APP_INSTALLATION_ID"); value != "" {
+		installationID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_INSTALLATION_ID must be a number: %w", err)
+		}
+	}
+
+	return &ghclient.AppConfig{
+		AppID:          appID,
+		PrivateKey:     privateKey,
+		InstallationID: installationID,
+	}, nil
+}
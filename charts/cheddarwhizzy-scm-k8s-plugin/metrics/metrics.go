@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value exposed on /metrics
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Counter{}
+)
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if c, exists := registry[name]; exists {
+		return c
+	}
+	c := &Counter{name: name, help: help}
+	registry[name] = c
+	return c
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n int) {
+	c.value.Add(int64(n))
+}
+
+// Value returns the current counter value
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+// Handler serves all registered counters in the Prometheus text format
+func Handler(w http.ResponseWriter, r *http.Request) {
+	registryMu.Lock()
+	counters := make([]*Counter, 0, len(registry))
+	for _, c := range registry {
+		counters = append(counters, c)
+	}
+	registryMu.Unlock()
+
+	sort.Slice(counters, func(i, j int) bool { return counters[i].name < counters[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+		fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+	}
+}
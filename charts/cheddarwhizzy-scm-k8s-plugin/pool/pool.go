@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds the number of goroutines started by ForEach calls sharing
+// the same context, including nested ones
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter creates a limiter allowing n concurrent workers (at least 1)
+func NewLimiter(n int) *Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return &Limiter{slots: make(chan struct{}, n-1)}
+}
+
+type limiterKey struct{}
+
+// WithLimiter returns a context whose ForEach calls share l
+func WithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// ForEach calls fn for every index in [0, n). Work runs on a new goroutine
+// while the context's limiter has a free slot and inline otherwise, so nested
+// calls never wait on each other; without a limiter everything runs inline.
+// Callers store results by index to keep the output order deterministic.
+// The first error cancels the context of the remaining calls and is returned
+// after all started calls have finished.
+func ForEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	limiter, _ := ctx.Value(limiterKey{}).(*Limiter)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		if limiter != nil {
+			select {
+			case limiter.slots <- struct{}{}:
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					defer func() { <-limiter.slots }()
+					if err := fn(ctx, i); err != nil {
+						fail(err)
+					}
+				}(i)
+				continue
+			default:
+			}
+		}
+		if err := fn(ctx, i); err != nil {
+			fail(err)
+		}
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	// The caller's context was cancelled, e.g. by ArgoCD's request timeout
+	return ctx.Err()
+}
@@ -0,0 +1,122 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachBoundsConcurrency(t *testing.T) {
+	ctx := WithLimiter(context.Background(), NewLimiter(3))
+
+	var running, peak atomic.Int32
+	work := func() {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+	}
+
+	// Nested calls share the limiter of the outer call
+	err := ForEach(ctx, 4, func(ctx context.Context, i int) error {
+		return ForEach(ctx, 4, func(ctx context.Context, j int) error {
+			work()
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The limiter bounds new goroutines; the calling goroutine also works
+	if p := peak.Load(); p > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", p)
+	}
+}
+
+func TestForEachWithoutLimiterRunsInline(t *testing.T) {
+	var order []int
+	err := ForEach(context.Background(), 5, func(ctx context.Context, i int) error {
+		order = append(order, i)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("order = %v, want 0..4 in sequence", order)
+		}
+	}
+}
+
+func TestForEachResultsByIndex(t *testing.T) {
+	ctx := WithLimiter(context.Background(), NewLimiter(4))
+	results := make([]int, 20)
+	err := ForEach(ctx, len(results), func(ctx context.Context, i int) error {
+		// Later indexes finish first
+		time.Sleep(time.Duration(len(results)-i) * time.Millisecond)
+		results[i] = i * i
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, got := range results {
+		if got != i*i {
+			t.Errorf("results[%d] = %d, want %d", i, got, i*i)
+		}
+	}
+}
+
+func TestForEachFirstErrorCancels(t *testing.T) {
+	ctx := WithLimiter(context.Background(), NewLimiter(2))
+	first := errors.New("first")
+
+	var started, cancelled atomic.Int32
+	err := ForEach(ctx, 10, func(ctx context.Context, i int) error {
+		started.Add(1)
+		if i == 0 {
+			return first
+		}
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return errors.New("later")
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	if !errors.Is(err, first) {
+		t.Errorf("err = %v, want the first error", err)
+	}
+	if started.Load() == 10 {
+		t.Error("no call should start after the first error")
+	}
+	if started.Load() > 1 && cancelled.Load() != started.Load()-1 {
+		t.Errorf("%d calls started but only %d saw the cancellation", started.Load()-1, cancelled.Load())
+	}
+}
+
+func TestForEachCallerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := ForEach(ctx, 3, func(ctx context.Context, i int) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if called {
+		t.Error("no call should start with a cancelled context")
+	}
+}
@@ -0,0 +1,82 @@
+package scm
+
+import (
+	"strings"
+	"time"
+)
+
+// RepoFilter selects repositories by metadata before any path is probed.
+// The zero value matches every repository.
+type RepoFilter struct {
+	// Topics must all be set on a repository
+	Topics []string
+	// ExcludeTopics must not be set on a repository
+	ExcludeTopics []string
+	// Visibility is "public", "private" or "internal"; empty matches any
+	Visibility string
+	// Archived and Fork select archived repositories / forks when true and
+	// exclude them when false; nil matches both
+	Archived *bool
+	Fork     *bool
+	// PushedAfter excludes repositories without a push since then (zero disables)
+	PushedAfter time.Time
+	// Name, when set, must accept the owner and name of a repository
+	Name func(owner, name string) bool
+}
+
+// RepoMetadata is the repository information a RepoFilter looks at
+type RepoMetadata struct {
+	Topics     []string
+	Visibility string
+	Archived   bool
+	Fork       bool
+	PushedAt   time.Time
+}
+
+// Matches reports whether a repository with the given metadata passes the filter
+func (f RepoFilter) Matches(meta RepoMetadata) bool {
+	if f.Visibility != "" && !strings.EqualFold(f.Visibility, meta.Visibility) {
+		return false
+	}
+	if f.Archived != nil && *f.Archived != meta.Archived {
+		return false
+	}
+	if f.Fork != nil && *f.Fork != meta.Fork {
+		return false
+	}
+	if !f.PushedAfter.IsZero() && meta.PushedAt.Before(f.PushedAfter) {
+		return false
+	}
+	for _, topic := range f.Topics {
+		if !hasTopic(meta.Topics, topic) {
+			return false
+		}
+	}
+	for _, topic := range f.ExcludeTopics {
+		if hasTopic(meta.Topics, topic) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesName reports whether a repository passes the Name check. Providers
+// check it before probing or reading metadata of the repository.
+func (f RepoFilter) MatchesName(owner, name string) bool {
+	return f.Name == nil || f.Name(owner, name)
+}
+
+// NeedsPushedAt reports whether the filter looks at the last push time
+func (f RepoFilter) NeedsPushedAt() bool {
+	return !f.PushedAfter.IsZero()
+}
+
+// hasTopic reports whether topics contains topic; topics are case-insensitive
+func hasTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if strings.EqualFold(t, topic) {
+			return true
+		}
+	}
+	return false
+}
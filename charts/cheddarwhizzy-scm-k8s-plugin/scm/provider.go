@@ -0,0 +1,70 @@
+package scm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// ErrNotFound is wrapped by providers when a repository, path or file does not exist
+var ErrNotFound = errors.New("not found")
+
+// IsNotFound reports whether err means the requested object does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// Repository identifies a repository discovered by a provider
+type Repository struct {
+	// Owner is the org, user or (sub)group path the repository lives in
+	Owner string
+	// Name is the repository name without its owner
+	Name string
+	// URL is the clone URL emitted in generated parameters
+	URL string
+}
+
+// Provider is the set of SCM reads the generator relies on.
+// Methods report missing objects with an error wrapping ErrNotFound, except
+// HasPath and ListChartFiles which report them as false / an empty map.
+type Provider interface {
+	// Name returns the provider name used in the "provider" input parameter
+	Name() string
+
+	// ReadProjectInfo reads project-info.yaml from the repository root
+	ReadProjectInfo(ctx context.Context, owner, repo, branch string) (*types.ProjectInfo, error)
+
+	// ReadArgoCDConfig reads argocd-config.yaml from a chart directory
+	ReadArgoCDConfig(ctx context.Context, owner, repo, branch, chartPath string) (*types.ArgoCDConfig, error)
+
+	// ReadFile returns the content of a file
+	ReadFile(ctx context.Context, owner, repo, branch, path string) ([]byte, error)
+
+	// DiscoverCharts returns chart directory names under envPath.
+	// Charts that were confirmed may be returned together with an error.
+	DiscoverCharts(ctx context.Context, owner, repo, branch, envPath string) ([]string, error)
+
+	// ListChartFiles returns the names of the files in a chart directory
+	ListChartFiles(ctx context.Context, owner, repo, branch, chartDirPath string) (map[string]bool, error)
+
+	// HasPath checks if a path exists in a repository
+	HasPath(ctx context.Context, owner, repo, branch, path string) (bool, error)
+
+	// DiscoverRepos returns repositories under org that pass filter and have
+	// deployment/k8s/<env> paths.
+	// Repositories that were confirmed may be returned together with an error.
+	DiscoverRepos(ctx context.Context, org string, envs []string, defaultBranch string, filter RepoFilter) ([]Repository, error)
+
+	// RepoURL builds the clone URL for a repository
+	RepoURL(owner, repo string) string
+
+	// ParseRepoURL extracts owner and repository name from a clone URL
+	ParseRepoURL(url string) (string, string, error)
+}
+
+// Invalidator is implemented by providers that cache repository data
+type Invalidator interface {
+	// Invalidate drops cached data of a repository at ref
+	Invalidate(owner, repo, ref string)
+}
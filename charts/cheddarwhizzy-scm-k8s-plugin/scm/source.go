@@ -0,0 +1,105 @@
+package scm
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/types"
+)
+
+// ChartSourceFile declares that the chart of a directory comes from an
+// external Helm repository or OCI registry
+const ChartSourceFile = "chart-source.yaml"
+
+// KustomizationFiles are the file names kustomize recognizes in an overlay
+var KustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// IsKustomization reports whether a directory with files is a kustomize overlay
+func IsKustomization(files map[string]bool) bool {
+	for _, name := range KustomizationFiles {
+		if files[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceType classifies a directory under deployment/k8s/<env> by its files:
+// a kustomize overlay, a Helm chart (values.yaml or chart-source.yaml), jsonnet or plain
+// manifests. It returns "" for directories that hold no app. clusters are the
+// env's clusters, whose values-<cluster>.yaml and image-<cluster>.yaml are not
+// manifests; without them every such file is taken for one.
+func SourceType(files map[string]bool, clusters ...string) string {
+	switch {
+	case IsKustomization(files):
+		return types.SourceTypeKustomize
+	case files["values.yaml"] || files[ChartSourceFile]:
+		return types.SourceTypeHelm
+	}
+
+	sourceType := ""
+	for name := range files {
+		if path.Ext(name) == ".jsonnet" {
+			return types.SourceTypeJsonnet
+		}
+		if isManifest(name, clusters) {
+			sourceType = types.SourceTypeDirectory
+		}
+	}
+	return sourceType
+}
+
+// IsChartDir reports whether a directory under deployment/k8s/<env> holds an app
+func IsChartDir(files map[string]bool) bool {
+	return SourceType(files) != ""
+}
+
+// pluginFiles are the files of an env directory the plugin reads itself
+var pluginFiles = []string{"values.yaml", "image.yaml", "argocd-config.yaml", ChartSourceFile}
+
+// IsPluginFile reports whether a file of an env directory is read by the
+// plugin rather than deployed: one of pluginFiles, or the values-<cluster>.yaml
+// or image-<cluster>.yaml of one of clusters
+func IsPluginFile(name string, clusters []string) bool {
+	for _, file := range pluginFiles {
+		if name == file {
+			return true
+		}
+	}
+	for _, cluster := range clusters {
+		if name == "values-"+cluster+".yaml" || name == "image-"+cluster+".yaml" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeGlob returns the directory.exclude of plain manifest and jsonnet
+// Applications: a glob matching the plugin files among files, or "" if none
+func ExcludeGlob(files map[string]bool, clusters []string) string {
+	var excluded []string
+	for name := range files {
+		if IsPluginFile(name, clusters) {
+			excluded = append(excluded, name)
+		}
+	}
+	switch len(excluded) {
+	case 0:
+		return ""
+	case 1:
+		return excluded[0]
+	}
+	sort.Strings(excluded)
+	return "{" + strings.Join(excluded, ",") + "}"
+}
+
+// isManifest reports whether a file is a plain Kubernetes manifest rather
+// than Helm values or plugin configuration
+func isManifest(name string, clusters []string) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return !IsPluginFile(name, clusters)
+	}
+	return false
+}
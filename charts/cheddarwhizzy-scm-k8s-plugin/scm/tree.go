@@ -0,0 +1,84 @@
+package scm
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Tree is a snapshot of the paths in a repository at one revision.
+// It answers path and directory listing questions without further SCM calls.
+type Tree struct {
+	// children maps a directory ("" for the root) to its entries, true for subdirectories
+	children map[string]map[string]bool
+}
+
+// NewTree builds a tree from the repository-relative paths of all files
+func NewTree(files []string) *Tree {
+	t := &Tree{children: map[string]map[string]bool{"": {}}}
+	for _, file := range files {
+		t.add(strings.Trim(file, "/"), false)
+	}
+	return t
+}
+
+// add registers p and all of its parent directories
+func (t *Tree) add(p string, isDir bool) {
+	if p == "" || p == "." {
+		return
+	}
+	dir, name := path.Split(p)
+	dir = strings.TrimSuffix(dir, "/")
+	if _, exists := t.children[dir]; !exists {
+		t.children[dir] = map[string]bool{}
+		t.add(dir, true)
+	}
+	if isDir {
+		t.children[dir][name] = true
+		if _, exists := t.children[p]; !exists {
+			t.children[p] = map[string]bool{}
+		}
+	} else if !t.children[dir][name] {
+		t.children[dir][name] = false
+	}
+}
+
+// HasPath reports whether p exists as a file or directory
+func (t *Tree) HasPath(p string) bool {
+	p = strings.Trim(p, "/")
+	if _, isDir := t.children[p]; isDir {
+		return true
+	}
+	dir, name := path.Split(p)
+	_, exists := t.children[strings.TrimSuffix(dir, "/")][name]
+	return exists
+}
+
+// IsDir reports whether p exists as a directory
+func (t *Tree) IsDir(p string) bool {
+	_, exists := t.children[strings.Trim(p, "/")]
+	return exists
+}
+
+// ListFiles returns the names of the files directly inside dir
+func (t *Tree) ListFiles(dir string) map[string]bool {
+	files := make(map[string]bool)
+	for name, isDir := range t.children[strings.Trim(dir, "/")] {
+		if !isDir {
+			files[name] = true
+		}
+	}
+	return files
+}
+
+// ListDirs returns the sorted names of the directories directly inside dir
+func (t *Tree) ListDirs(dir string) []string {
+	var dirs []string
+	for name, isDir := range t.children[strings.Trim(dir, "/")] {
+		if isDir {
+			dirs = append(dirs, name)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
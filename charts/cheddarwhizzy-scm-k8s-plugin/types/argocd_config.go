@@ -6,6 +6,8 @@ type ArgoCDConfig struct {
 	SyncOptions          []string                 `yaml:"syncOptions,omitempty"`
 	IgnoreDifferences    []IgnoreDifferenceConfig `yaml:"ignoreDifferences,omitempty"`
 	RevisionHistoryLimit *int                     `yaml:"revisionHistoryLimit,omitempty"`
+	// ChartSource declares an external Helm or OCI chart, like chart-source.yaml
+	ChartSource *ChartSource `yaml:"chartSource,omitempty"`
 }
 
 type SyncPolicyConfig struct {
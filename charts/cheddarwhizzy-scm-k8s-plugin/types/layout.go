@@ -1,5 +1,7 @@
 package types
 
+import "regexp"
+
 // LayoutStrategy defines how to parse repo paths
 type LayoutStrategy string
 
@@ -29,7 +31,7 @@ type ClusterResolver struct {
 	FromPathIndex *int `yaml:"fromPathIndex,omitempty"`
 
 	// For split repos: regex pattern to extract from repo name
-	// e.g., "kubernetes-(.+)-(.+)" captures env and cluster
+	// e.g., "^kubernetes-(?P<env>[^-]+)-(?P<cluster>.+)$" captures env and cluster
 	FromRepoPattern *string `yaml:"fromRepoPattern,omitempty"`
 
 	// Static value (fallback)
@@ -52,6 +54,28 @@ type PathStructure struct {
 
 	// Index where chart name appears (default: 3 for monorepo)
 	ChartIndex int `yaml:"chartIndex"`
+
+	// Template replaces the indexes when set, e.g.
+	// "clusters/{cluster}/namespaces/{namespace}/{chart}" or "**/{type}/{namespace}/{chart}".
+	// {cluster}, {env}, {type}, {namespace} and {chart} fill the resolved layout;
+	// other placeholders are exposed as captures.
+	Template string `yaml:"template,omitempty"`
+}
+
+// LayoutRulesFile is the layout config file (LAYOUT_CONFIG_FILE)
+type LayoutRulesFile struct {
+	Rules []LayoutRule `yaml:"rules"`
+}
+
+// LayoutRule assigns a layout to the repositories it matches; the first
+// matching rule wins
+type LayoutRule struct {
+	// Regex matched against "<org>/<repo>"
+	Match  string       `yaml:"match"`
+	Layout LayoutConfig `yaml:"layout"`
+
+	// Pattern is Match compiled by the config loader
+	Pattern *regexp.Regexp `yaml:"-"`
 }
 
 // ResolvedLayout contains the parsed components
@@ -61,5 +85,7 @@ type ResolvedLayout struct {
 	Type      string // "infra" or "apps"
 	Namespace string
 	Chart     string
+	// Captures holds extra named placeholders of a path template
+	Captures map[string]string
 }
 
@@ -1,26 +1,57 @@
 package types
 
+import (
+	"time"
+
+	"github.com/cheddarwhizzy/argocd-scm-k8s-plugin/cluster"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
 // PluginInput represents the input from ArgoCD ApplicationSet
 type PluginInput struct {
 	Input struct {
-		Parameters struct {
-			// Standalone mode: discover repos by org
-			Orgs []string `json:"orgs,omitempty"`
-			// Matrix mode: receive repo info from scmProvider
-			URL          string `json:"url,omitempty"`
-			Repository   string `json:"repository,omitempty"`
-			Organization string `json:"organization,omitempty"`
-			// Path mode: receive path from git directory generator
-			Path    string `json:"path,omitempty"`
-			RepoURL string `json:"repoURL,omitempty"`
-			// Common parameters
-			Envs            []string `json:"envs"`
-			IncludePatterns []string `json:"includePatterns,omitempty"`
-			Branch          string   `json:"branch,omitempty"`
-		} `json:"parameters"`
+		Parameters PluginParameters `json:"parameters"`
 	} `json:"input"`
 }
 
+// PluginParameters represents the parameters block of a plugin request
+type PluginParameters struct {
+	// Standalone mode: discover repos by org
+	Orgs []string `json:"orgs,omitempty"`
+	// Matrix mode: receive repo info from scmProvider
+	URL          string `json:"url,omitempty"`
+	Repository   string `json:"repository,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	// Standalone mode repository filters, applied before any path is probed
+	Topics        []string `json:"topics,omitempty"`        // all required
+	ExcludeTopics []string `json:"excludeTopics,omitempty"` // none allowed
+	Visibility    string   `json:"visibility,omitempty"`    // public, private or internal
+	Archived      *bool    `json:"archived,omitempty"`      // true: only archived, false: no archived
+	Fork          *bool    `json:"fork,omitempty"`          // true: only forks, false: no forks
+	PushedWithin  string   `json:"pushedWithin,omitempty"`  // e.g. "90d" or "720h"
+	// Path mode: receive path from git directory generator
+	Path    string `json:"path,omitempty"`
+	RepoURL string `json:"repoURL,omitempty"`
+	// Common parameters
+	Envs []string `json:"envs"`
+	// IncludePatterns and ExcludePatterns select repos, charts and envs:
+	// "[repo:|chart:|env:]<glob>" or "[scope:]/<regex>/", unscoped means repo
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	Branch          string   `json:"branch,omitempty"`
+	// Strict overrides Config.StrictMode for this request
+	Strict *bool `json:"strict,omitempty"`
+	// Provider selects the SCM provider (github, gitlab, local); defaults to Config.DefaultProvider
+	Provider string `json:"provider,omitempty"`
+	// Parallelism lowers Config.Parallelism for this request
+	Parallelism int `json:"parallelism,omitempty"`
+	// MultiSource emits chartSource and valuesSource for multi-source
+	// Applications, with valueFiles read through the $values ref
+	MultiSource bool `json:"multiSource,omitempty"`
+	// AllowDeletions accepts a result the mass-deletion guard would hold back
+	AllowDeletions bool `json:"allowDeletions,omitempty"`
+}
+
 // ProjectInfo represents the project-info.yaml structure
 type ProjectInfo struct {
 	Name       string                `yaml:"name"`
@@ -34,13 +65,25 @@ type ProjectInfoDeployment struct {
 
 type EnvironmentConfig struct {
 	Clusters []ClusterConfig `yaml:"clusters"`
+	// ClusterSelector adds the registry clusters of the env matching a label
+	// selector, e.g. "region in (us, eu),tier=edge"
+	ClusterSelector string `yaml:"clusterSelector,omitempty"`
 }
 
 type ClusterConfig struct {
 	Name            string `yaml:"name"`
 	DestinationName string `yaml:"destinationName"`
+	Server          string `yaml:"server,omitempty"`
 }
 
+// Source types of a generated Application
+const (
+	SourceTypeHelm      = "helm"
+	SourceTypeKustomize = "kustomize"
+	SourceTypeDirectory = "directory" // plain manifests
+	SourceTypeJsonnet   = "jsonnet"
+)
+
 // Parameter represents a single ApplicationSet parameter
 type Parameter struct {
 	Organization         string                   `json:"organization"`
@@ -50,8 +93,11 @@ type Parameter struct {
 	Env                  string                   `json:"env"`
 	ChartName            string                   `json:"chartName"`
 	ChartPath            string                   `json:"chartPath"`
+	SourceType           string                   `json:"sourceType,omitempty"`       // helm, kustomize, directory or jsonnet
+	DirectoryExclude     string                   `json:"directoryExclude,omitempty"` // directory.exclude of directory and jsonnet sources
 	Cluster              string                   `json:"cluster"`
 	DestinationName      string                   `json:"destinationName"`
+	DestinationServer    string                   `json:"destinationServer,omitempty"`
 	Namespace            string                   `json:"namespace"`
 	ValueFiles           []string                 `json:"valueFiles"`
 	ApplicationName      string                   `json:"applicationName"`
@@ -59,6 +105,62 @@ type Parameter struct {
 	SyncPolicy           *SyncPolicyConfig        `json:"syncPolicy,omitempty"`
 	IgnoreDifferences    []IgnoreDifferenceConfig `json:"ignoreDifferences,omitempty"`
 	RevisionHistoryLimit *int                     `json:"revisionHistoryLimit,omitempty"`
+	// Captures holds extra named placeholders of a path template layout
+	Captures map[string]string `json:"captures,omitempty"`
+	// ChartSource and ValuesSource are set for Helm charts in multi-source mode
+	ChartSource  *ChartSource  `json:"chartSource,omitempty"`
+	ValuesSource *ValuesSource `json:"valuesSource,omitempty"`
+	// ChartVersion, AppVersion and Dependencies come from the Chart.yaml of
+	// the base chart of Helm sources
+	ChartVersion string            `json:"chartVersion,omitempty"`
+	AppVersion   string            `json:"appVersion,omitempty"`
+	Dependencies []ChartDependency `json:"dependencies,omitempty"`
+	// ImageRepository and ImageTag are the image of Helm sources set by
+	// image.yaml, overridden by image-<cluster>.yaml
+	ImageRepository string `json:"imageRepository,omitempty"`
+	ImageTag        string `json:"imageTag,omitempty"`
+}
+
+// Image is the image an image.yaml sets through the Helm values
+// image.repository and image.tag
+type Image struct {
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag"`
+}
+
+// Chart is the part of a Chart.yaml exposed as parameters
+type Chart struct {
+	Name         string            `yaml:"name"`
+	Version      string            `yaml:"version"`
+	AppVersion   string            `yaml:"appVersion"`
+	Dependencies []ChartDependency `yaml:"dependencies"`
+}
+
+// ChartDependency is a subchart declared in Chart.yaml
+type ChartDependency struct {
+	Name       string `json:"name" yaml:"name"`
+	Version    string `json:"version,omitempty" yaml:"version"`
+	Repository string `json:"repository,omitempty" yaml:"repository"`
+	Alias      string `json:"alias,omitempty" yaml:"alias"`
+	Condition  string `json:"condition,omitempty" yaml:"condition"`
+}
+
+// ChartSource is the chart source of a multi-source Application:
+// a chart directory in a git repository (Path) or a chart in a Helm or OCI
+// repository (Chart), as declared in chart-source.yaml
+type ChartSource struct {
+	RepoURL        string `json:"repoURL" yaml:"repoURL"`
+	Path           string `json:"path,omitempty" yaml:"path,omitempty"`
+	Chart          string `json:"chart,omitempty" yaml:"chart,omitempty"`
+	TargetRevision string `json:"targetRevision" yaml:"targetRevision"`
+}
+
+// ValuesSource is the source of a multi-source Application that value files
+// are read from as $<ref>/<path>
+type ValuesSource struct {
+	RepoURL        string `json:"repoURL"`
+	TargetRevision string `json:"targetRevision"`
+	Ref            string `json:"ref"`
 }
 
 // PluginResponse represents the response from the plugin (ArgoCD format)
@@ -72,7 +174,35 @@ type PluginResponse struct {
 // Config holds the plugin configuration
 type Config struct {
 	GitHubToken     string
+	GitLabToken     string
+	GitLabURL       string
+	LocalReposRoot  string
+	LocalRepoURL    string
+	DefaultProvider string
 	DefaultClusters []ClusterConfig
 	DefaultBranch   string
+	// StrictMode fails the whole request on any upstream error other than
+	// "not found" instead of returning a partial parameter list
+	StrictMode bool
+	// MaxDeletionPercent and MaxDeletionCount limit how many Applications a
+	// new result may drop compared to the last successful one (0 disables)
+	MaxDeletionPercent float64
+	MaxDeletionCount   int
+	// MinDeletionBaseline is the number of Applications below which
+	// MaxDeletionPercent does not apply
+	MinDeletionBaseline int
+	// DeletionAcceptAfter accepts a held back result once it has been
+	// generated unchanged for this long (0 never accepts)
+	DeletionAcceptAfter time.Duration
+	// Parallelism bounds the concurrent repo, env and chart lookups of a request
+	Parallelism int
+	// LayoutRules select the layout of a repository; nil uses the built-in rules
+	LayoutRules []LayoutRule
+	// Clusters maps cluster names to ArgoCD destinations for path mode and
+	// cluster selectors; nil uses path cluster names as destination names
+	Clusters *cluster.Registry
+	// DefaultClusterSelector, when set, selects registry clusters instead of
+	// DefaultClusters for envs without clusters in project-info.yaml
+	DefaultClusterSelector labels.Selector
 }
 
@@ -3,8 +3,12 @@ package utils
 import (
 	"crypto/md5"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // getEnvOrDefault returns environment variable value or default
@@ -15,6 +19,70 @@ func GetEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// GetEnvBoolOrDefault returns environment variable parsed as a bool or default.
+// A value that does not parse stops the process.
+func GetEnvBoolOrDefault(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, value, err)
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+// GetEnvIntOrDefault returns environment variable parsed as an int or default.
+// A value that does not parse stops the process.
+func GetEnvIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, value, err)
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+// GetEnvFloatOrDefault returns environment variable parsed as a float or default.
+// A value that does not parse stops the process.
+func GetEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, value, err)
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+// GetEnvDurationOrDefault returns environment variable parsed as a duration or default.
+// A value that does not parse stops the process.
+func GetEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, value, err)
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+// ParseDuration parses a Go duration, additionally accepting whole days such as "90d"
+func ParseDuration(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
 // generateApplicationName generates a safe Helm release name that:
 // - Is <= 53 characters
 // - Matches Helm's regex: ^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$
@@ -111,29 +179,49 @@ func TruncateString(s string, maxLen int) string {
 }
 
 // ParseRepoURL extracts owner and repo name from a git URL
-func ParseRepoURL(url string) (string, string, error) {
-	// Handle git@github.com:owner/repo.git
-	if strings.HasPrefix(url, "git@github.com:") {
-		parts := strings.TrimPrefix(url, "git@github.com:")
-		parts = strings.TrimSuffix(parts, ".git")
-		split := strings.Split(parts, "/")
-		if len(split) != 2 {
-			return "", "", fmt.Errorf("invalid git URL format: %s", url)
-		}
-		return split[0], split[1], nil
-	}
+// Supported formats, on any host and with or without the .git suffix:
+//   - git@host:owner/repo.git
+//   - ssh://git@host[:port]/owner/repo.git
+//   - https://host/owner/repo.git (also http:// and git://)
+//
+// Owners may contain slashes (e.g. GitLab subgroups); the last path segment is the repo.
+func ParseRepoURL(repoURL string) (string, string, error) {
+	_, owner, repo, err := ParseRepoURLWithHost(repoURL)
+	return owner, repo, err
+}
+
+// ParseRepoURLWithHost is ParseRepoURL that also returns the host
+func ParseRepoURLWithHost(repoURL string) (string, string, string, error) {
+	var host, repoPath string
 
-	// Handle https://github.com/owner/repo.git
-	if strings.HasPrefix(url, "https://github.com/") {
-		parts := strings.TrimPrefix(url, "https://github.com/")
-		parts = strings.TrimSuffix(parts, ".git")
-		split := strings.Split(parts, "/")
-		if len(split) != 2 {
-			return "", "", fmt.Errorf("invalid HTTPS URL format: %s", url)
+	if idx := strings.Index(repoURL, "://"); idx >= 0 {
+		parsed, err := url.Parse(repoURL)
+		if err != nil || parsed.Host == "" {
+			return "", "", "", fmt.Errorf("invalid URL format: %s", repoURL)
 		}
-		return split[0], split[1], nil
+		switch parsed.Scheme {
+		case "ssh", "https", "http", "git":
+		default:
+			return "", "", "", fmt.Errorf("unsupported URL scheme %q: %s", parsed.Scheme, repoURL)
+		}
+		host = parsed.Hostname()
+		repoPath = parsed.Path
+	} else {
+		// scp-like syntax: [user@]host:owner/repo
+		at := strings.Index(repoURL, "@")
+		colon := strings.Index(repoURL, ":")
+		if colon <= at+1 {
+			return "", "", "", fmt.Errorf("unsupported URL format: %s", repoURL)
+		}
+		host = repoURL[at+1 : colon]
+		repoPath = repoURL[colon+1:]
 	}
 
-	return "", "", fmt.Errorf("unsupported URL format: %s", url)
+	repoPath = strings.Trim(repoPath, "/")
+	repoPath = strings.TrimSuffix(repoPath, ".git")
+	idx := strings.LastIndex(repoPath, "/")
+	if idx <= 0 || idx == len(repoPath)-1 {
+		return "", "", "", fmt.Errorf("invalid git URL format: %s", repoURL)
+	}
+	return host, repoPath[:idx], repoPath[idx+1:], nil
 }
-